@@ -3,10 +3,17 @@ package main
 import (
     "bufio"
     "bytes"
+    "crypto/rand"
+    "encoding/hex"
     "encoding/json"
+    "errors"
     "fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
@@ -14,8 +21,116 @@ import (
 
 	"terminal_store/pkg/env"
 	"terminal_store/pkg/models"
+	"terminal_store/pkg/validate"
 )
 
+const pageSize = 20
+
+// authToken is sent as a bearer token with every request: the access token
+// of the logged-in user, or API_KEY on terminals that run without a login.
+var authToken string
+
+// session is the staff login in use, if any. It is cached on disk so
+// restarting the CLI does not ask for the password again.
+var session *savedSession
+
+type savedSession struct {
+    Username     string `json:"username"`
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+}
+
+// tokenResponse is what /auth/login and /auth/refresh answer with.
+type tokenResponse struct {
+    AccessToken  string      `json:"access_token"`
+    RefreshToken string      `json:"refresh_token"`
+    User         models.User `json:"user"`
+}
+
+func sessionPath() (string, error) {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(dir, "terminal_store", "session.json"), nil
+}
+
+func loadSession() *savedSession {
+    path, err := sessionPath()
+    if err != nil {
+        return nil
+    }
+    b, err := os.ReadFile(path)
+    if err != nil {
+        return nil
+    }
+    var saved savedSession
+    if json.Unmarshal(b, &saved) != nil || saved.AccessToken == "" {
+        return nil
+    }
+    return &saved
+}
+
+// saveSession writes the tokens where only the current OS user can read
+// them.
+func saveSession(saved *savedSession) error {
+    path, err := sessionPath()
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+        return err
+    }
+    b, err := json.Marshal(saved)
+    if err != nil {
+        return err
+    }
+    if err := os.WriteFile(path, b, 0o600); err != nil {
+        return err
+    }
+    return os.Chmod(path, 0o600)
+}
+
+func removeSession() {
+    if path, err := sessionPath(); err == nil {
+        os.Remove(path)
+    }
+}
+
+func useSession(t tokenResponse) {
+    session = &savedSession{Username: t.User.Username, AccessToken: t.AccessToken, RefreshToken: t.RefreshToken}
+    authToken = t.AccessToken
+    if err := saveSession(session); err != nil {
+        fmt.Println("Warning: could not cache login:", err)
+    }
+}
+
+// refreshLogin trades the session's refresh token for new tokens once the
+// short-lived access token has expired.
+func refreshLogin(baseURL string) error {
+    b, err := json.Marshal(map[string]string{"refresh_token": session.RefreshToken})
+    if err != nil {
+        return err
+    }
+    client := http.Client{Timeout: 4 * time.Second}
+    resp, err := client.Post(baseURL+"/auth/refresh", "application/json", bytes.NewReader(b))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        session = nil
+        removeSession()
+        return newStatusError(resp)
+    }
+    var t tokenResponse
+    if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+        return err
+    }
+    useSession(t)
+    return nil
+}
+
 func serverUp(baseURL string) bool {
     client := http.Client{Timeout: 800 * time.Millisecond}
     resp, err := client.Get(baseURL + "/health")
@@ -26,41 +141,184 @@ func serverUp(baseURL string) bool {
     return resp.StatusCode == 200
 }
 
+// statusError is returned for non-2xx responses so callers can react to
+// particular status codes. apiErr holds the server's explanation when the
+// body carried one.
+type statusError struct {
+    code   int
+    status string
+    apiErr *models.APIError
+}
+
+func newStatusError(resp *http.Response) *statusError {
+    var body struct {
+        Error *models.APIError `json:"error"`
+    }
+    json.NewDecoder(resp.Body).Decode(&body)
+    return &statusError{code: resp.StatusCode, status: resp.Status, apiErr: body.Error}
+}
+
+func (e *statusError) Error() string {
+    if e.apiErr == nil {
+        return "server error: " + e.status
+    }
+    if e.code >= http.StatusInternalServerError && e.apiErr.RequestID != "" {
+        return e.apiErr.Error() + " (request " + e.apiErr.RequestID + ")"
+    }
+    return e.apiErr.Error()
+}
+
+func authorize(req *http.Request) {
+    if authToken != "" {
+        req.Header.Set("Authorization", "Bearer "+authToken)
+    }
+}
+
+// do sends req with the current credentials. When a logged-in user's access
+// token has expired it refreshes the login and sends req once more.
+func do(req *http.Request, timeout time.Duration) (*http.Response, error) {
+    authorize(req)
+    client := http.Client{Timeout: timeout}
+    resp, err := client.Do(req)
+    if err != nil || resp.StatusCode != http.StatusUnauthorized || session == nil {
+        return resp, err
+    }
+    resp.Body.Close()
+    if err := refreshLogin(req.URL.Scheme + "://" + req.URL.Host); err != nil {
+        return nil, err
+    }
+    if req.GetBody != nil {
+        if req.Body, err = req.GetBody(); err != nil {
+            return nil, err
+        }
+    }
+    authorize(req)
+    return client.Do(req)
+}
+
+// isConflict reports whether err is a 412 from the server, meaning the
+// record changed since it was loaded.
+func isConflict(err error) bool {
+    var se *statusError
+    return errors.As(err, &se) && se.code == http.StatusPreconditionFailed
+}
+
 func getJSON[T any](url string, out *T) error {
-    client := http.Client{Timeout: 3 * time.Second}
-    resp, err := client.Get(url)
+    req, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := do(req, 3*time.Second)
     if err != nil {
         return err
     }
     defer resp.Body.Close()
     if resp.StatusCode >= 300 {
-        return fmt.Errorf("server error: %s", resp.Status)
+        return newStatusError(resp)
     }
     return json.NewDecoder(resp.Body).Decode(out)
 }
 
-func sendJSON[T any](method, url string, body any, out *T) error {
-    b, err := json.Marshal(body)
-    if err != nil {
-        return err
+type requestOption func(*http.Request)
+
+// withIfMatch makes the request apply only if the record is still at the
+// given version.
+func withIfMatch(version int) requestOption {
+    return func(req *http.Request) {
+        req.Header.Set("If-Match", `"`+strconv.Itoa(version)+`"`)
+    }
+}
+
+// withIdempotencyKey lets the server recognise a retried request and answer
+// it with the original response instead of applying it twice.
+func withIdempotencyKey(key string) requestOption {
+    return func(req *http.Request) {
+        req.Header.Set("Idempotency-Key", key)
+    }
+}
+
+func newIdempotencyKey() string {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        panic(err)
+    }
+    return hex.EncodeToString(b)
+}
+
+// isRetryable reports whether a request may not have reached the server or
+// failed there, so that resending it could succeed. That includes a 409 for
+// an Idempotency-Key whose first attempt is still running: once it
+// finishes, resending with the same key returns its response.
+func isRetryable(err error) bool {
+    var se *statusError
+    return !errors.As(err, &se) || se.code >= http.StatusInternalServerError || isKeyInUse(err)
+}
+
+// isKeyInUse reports whether err is the 409 for an Idempotency-Key that an
+// earlier attempt still holds.
+func isKeyInUse(err error) bool {
+    var se *statusError
+    return errors.As(err, &se) && se.code == http.StatusConflict && se.apiErr != nil && se.apiErr.Code == "idempotency_key_in_use"
+}
+
+func sendJSON[T any](method, url string, body any, out *T, opts ...requestOption) error {
+    var b []byte
+    if body != nil {
+        var err error
+        if b, err = json.Marshal(body); err != nil {
+            return err
+        }
     }
     req, err := http.NewRequest(method, url, bytes.NewReader(b))
     if err != nil {
         return err
     }
     req.Header.Set("Content-Type", "application/json")
-    client := http.Client{Timeout: 4 * time.Second}
-    resp, err := client.Do(req)
+    for _, opt := range opts {
+        opt(req)
+    }
+    resp, err := do(req, 4*time.Second)
     if err != nil {
         return err
     }
     defer resp.Body.Close()
     if resp.StatusCode >= 300 {
-        return fmt.Errorf("server error: %s", resp.Status)
+        return newStatusError(resp)
+    }
+    if out == nil || resp.StatusCode == http.StatusNoContent {
+        return nil
     }
     return json.NewDecoder(resp.Body).Decode(out)
 }
 
+// forEachPage walks a paginated list endpoint, handing each page to show and
+// asking before fetching the next one.
+func forEachPage[T any](reader *bufio.Reader, url string, show func([]T)) error {
+    sep := "?"
+    if strings.Contains(url, "?") {
+        sep = "&"
+    }
+    after := ""
+    for {
+        pageURL := url + sep + "limit=" + strconv.Itoa(pageSize)
+        if after != "" {
+            pageURL += "&after=" + after
+        }
+        var page models.Page[T]
+        if err := getJSON(pageURL, &page); err != nil {
+            return err
+        }
+        show(page.Data)
+        if page.NextCursor == "" {
+            return nil
+        }
+        if strings.ToLower(readLine(reader, "-- Enter for more, q to stop: ")) == "q" {
+            return nil
+        }
+        after = page.NextCursor
+    }
+}
+
 func readLine(reader *bufio.Reader, prompt string) string {
     fmt.Print(prompt)
     line, _ := reader.ReadString('\n')
@@ -78,164 +336,1642 @@ func readInt(reader *bufio.Reader, prompt string) (int64, error) {
     }
 }
 
-func readFloat(reader *bufio.Reader, prompt string) (float64, error) {
+// readDefault prompts with the current value and returns it unchanged when
+// the user just presses Enter.
+func readDefault(reader *bufio.Reader, label, current string) string {
+    text := readLine(reader, fmt.Sprintf("%s [%s]: ", label, current))
+    if text == "" {
+        return current
+    }
+    return text
+}
+
+func confirm(reader *bufio.Reader, prompt string) bool {
+    return strings.ToLower(readLine(reader, prompt+" (y/N): ")) == "y"
+}
+
+// retryOnConflict runs attempt, which loads a record and saves a change to
+// it, again for as long as the save hits a concurrent edit and the user
+// wants to reload and retry.
+func retryOnConflict(reader *bufio.Reader, what string, attempt func() error) error {
+    for {
+        err := attempt()
+        if !isConflict(err) {
+            return err
+        }
+        fmt.Printf("This %s was changed by someone else while you were editing.\n", what)
+        if !confirm(reader, "Reload and try again?") {
+            return nil
+        }
+    }
+}
+
+func readMoney(reader *bufio.Reader, prompt string) (models.Money, error) {
     for {
         text := readLine(reader, prompt)
-        v, err := strconv.ParseFloat(text, 64)
+        v, err := models.ParseMoney(text)
         if err == nil {
             return v, nil
         }
-        fmt.Println("Please enter a valid number.")
+        fmt.Println("Please enter a valid amount, e.g. 12.50.")
+    }
+}
+
+// checkRequest applies the server's validation rules to req before it is
+// sent, printing every problem. It reports whether req is fine to send.
+func checkRequest(req any) bool {
+    details := validate.Struct(req)
+    if len(details) > 0 {
+        fmt.Println("Not sent:")
+    }
+    for _, d := range details {
+        fmt.Printf("  %s %s\n", d.Field, d.Message)
+    }
+    return len(details) == 0
+}
+
+func printOrderTotals(o models.Order) {
+    fmt.Printf("  subtotal $%s", o.Subtotal)
+    if o.Discount != 0 {
+        fmt.Printf("  discount -$%s", o.Discount)
+    }
+    fmt.Printf("  tax $%s  total $%s\n", o.Tax, o.Total)
+}
+
+func printOrder(o models.Order) {
+    fmt.Printf("Order #%d customer=%d status=%s created=%s\n", o.ID, o.CustomerID, o.Status, o.CreatedAt.Format(time.RFC3339))
+    for _, it := range o.Items {
+        fmt.Printf("  item #%d product=%d variant=%d qty=%d price=%s line=%s", it.ID, it.ProductID, it.VariantID, it.Qty, it.PriceEach, it.LineTotal)
+        if it.Discount != 0 {
+            fmt.Printf(" discount=%s", it.Discount)
+        }
+        if it.ReturnedQty > 0 {
+            fmt.Printf(" returned=%d", it.ReturnedQty)
+        }
+        fmt.Println()
     }
+    printDiscounts(o)
+    printOrderTotals(o)
 }
 
-func menu(baseURL string) {
-    reader := bufio.NewReader(os.Stdin)
+// shop holds what every menu action needs.
+type shop struct {
+    reader  *bufio.Reader
+    baseURL string
+}
+
+type menuEntry struct {
+    label string
+    run   func()
+}
+
+func (s *shop) resourceURL(kind string, id int64) string {
+    return s.baseURL + "/" + kind + "/" + strconv.FormatInt(id, 10)
+}
 
+// runMenu shows a numbered menu until the user picks 0 or input ends.
+func (s *shop) runMenu(title, exitLabel string, entries []menuEntry) {
     for {
-        fmt.Println("\n--- MENU ---")
-        fmt.Println("1) List products")
-        fmt.Println("2) Add product")
-        fmt.Println("3) Update stock")
-        fmt.Println("4) List customers")
-        fmt.Println("5) Add customer")
-        fmt.Println("6) Create order")
-        fmt.Println("7) View orders")
-        fmt.Println("0) Exit")
+        fmt.Printf("\n--- %s ---\n", title)
+        for i, e := range entries {
+            fmt.Printf("%d) %s\n", i+1, e.label)
+        }
+        fmt.Printf("0) %s\n", exitLabel)
         fmt.Print("> ")
 
-        line, _ := reader.ReadString('\n')
+        line, err := s.reader.ReadString('\n')
         choice := strings.TrimSpace(line)
+        if choice == "0" || (err != nil && choice == "") {
+            return
+        }
+        n, convErr := strconv.Atoi(choice)
+        if convErr != nil || n < 1 || n > len(entries) {
+            fmt.Println("Invalid choice")
+            continue
+        }
+        entries[n-1].run()
+    }
+}
 
-        switch choice {
-        case "1":
-            var products []models.Product
-            if err := getJSON(baseURL+"/products", &products); err != nil {
-                fmt.Println("Error:", err)
-                continue
-            }
-            tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
-            fmt.Fprintln(tw, "ID\tNAME\tPRICE\tSTOCK\tCREATED")
-            for _, p := range products {
-                fmt.Fprintf(tw, "%d\t%s\t%.2f\t%d\t%s\n", p.ID, p.Name, p.Price, p.Stock, p.CreatedAt.Format(time.RFC3339))
-            }
-            tw.Flush()
-        case "2":
-            name := readLine(reader, "Product name: ")
-            price, _ := readFloat(reader, "Price: ")
-            stock, _ := readInt(reader, "Stock: ")
-            req := map[string]any{
-                "name":  name,
-                "price": price,
-                "stock": stock,
-            }
-            var created models.Product
-            if err := sendJSON(http.MethodPost, baseURL+"/products", req, &created); err != nil {
-                fmt.Println("Error:", err)
-                continue
-            }
-            fmt.Printf("Created product #%d\n", created.ID)
-        case "3":
-            pid, _ := readInt(reader, "Product ID: ")
-            stock, _ := readInt(reader, "New stock: ")
-            req := map[string]any{
-                "stock": stock,
-            }
-            var updated models.Product
-            if err := sendJSON(http.MethodPatch, baseURL+"/products/"+strconv.FormatInt(pid, 10)+"/stock", req, &updated); err != nil {
-                fmt.Println("Error:", err)
-                continue
-            }
-            fmt.Printf("Updated product #%d stock=%d\n", updated.ID, updated.Stock)
-        case "4":
-            var customers []models.Customer
-            if err := getJSON(baseURL+"/customers", &customers); err != nil {
-                fmt.Println("Error:", err)
-                continue
-            }
-            tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
-            fmt.Fprintln(tw, "ID\tNAME\tPHONE\tCREATED")
-            for _, c := range customers {
-                fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", c.ID, c.Name, c.Phone, c.CreatedAt.Format(time.RFC3339))
-            }
-            tw.Flush()
-        case "5":
-            name := readLine(reader, "Customer name: ")
-            phone := readLine(reader, "Phone (optional): ")
-            req := map[string]any{
-                "name":  name,
-                "phone": phone,
-            }
-            var created models.Customer
-            if err := sendJSON(http.MethodPost, baseURL+"/customers", req, &created); err != nil {
-                fmt.Println("Error:", err)
-                continue
-            }
-            fmt.Printf("Created customer #%d\n", created.ID)
-        case "6":
-            cid, _ := readInt(reader, "Customer ID: ")
-            items := make([]map[string]any, 0)
-            for {
-                pidText := readLine(reader, "Product ID (blank to finish): ")
-                if pidText == "" {
-                    break
-                }
-                pid, err := strconv.ParseInt(pidText, 10, 64)
-                if err != nil {
-                    fmt.Println("Invalid product id.")
-                    continue
-                }
-                qty, _ := readInt(reader, "Qty: ")
-                items = append(items, map[string]any{
-                    "product_id": pid,
-                    "qty":        qty,
-                })
-            }
-            req := map[string]any{
-                "customer_id": cid,
-                "items":       items,
-            }
-            var created models.Order
-            if err := sendJSON(http.MethodPost, baseURL+"/orders", req, &created); err != nil {
-                fmt.Println("Error:", err)
-                continue
-            }
-            total := 0.0
-            for _, it := range created.Items {
-                total += it.PriceEach * float64(it.Qty)
-            }
-            fmt.Printf("Created order #%d with %d items (total $%.2f)\n", created.ID, len(created.Items), total)
-        case "7":
-            var orders []models.Order
-            if err := getJSON(baseURL+"/orders", &orders); err != nil {
-                fmt.Println("Error:", err)
-                continue
+func (s *shop) mainMenu() {
+    s.runMenu("MENU", "Exit", []menuEntry{
+        {"Products", s.productsMenu},
+        {"Categories", s.categoriesMenu},
+        {"Customers", s.customersMenu},
+        {"Orders", s.ordersMenu},
+        {"Administration", s.adminMenu},
+        {"Change password", s.changePassword},
+        {"Switch user", s.switchUser},
+    })
+}
+
+func (s *shop) adminMenu() {
+    s.runMenu("ADMINISTRATION", "Back", []menuEntry{
+        {"List staff users", s.listUsers},
+        {"Add staff user", s.addUser},
+        {"Disable staff user", s.disableUser},
+        {"List API keys", s.listAPIKeys},
+        {"Create API key", s.createAPIKey},
+        {"Revoke API key", s.revokeAPIKey},
+        {"Audit log", s.auditLog},
+    })
+}
+
+func (s *shop) productsMenu() {
+    s.runMenu("PRODUCTS", "Back", []menuEntry{
+        {"List products", s.listProducts},
+        {"Search products", s.searchProducts},
+        {"Add product", s.addProduct},
+        {"Adjust stock", s.adjustStock},
+        {"Set stock after recount", s.updateStock},
+        {"Stock history", s.stockHistory},
+        {"View product", s.viewProduct},
+        {"Price history", s.priceHistory},
+        {"Schedule price change", s.schedulePrice},
+        {"List variants", s.listVariants},
+        {"Add option (e.g. Color)", s.addOption},
+        {"Add variant", s.addVariant},
+        {"Edit product", s.editProduct},
+        {"Delete product", s.deleteProduct},
+        {"Archive product", func() { s.setArchived("products", "product", true) }},
+        {"Restore archived product", func() { s.setArchived("products", "product", false) }},
+    })
+}
+
+func (s *shop) categoriesMenu() {
+    s.runMenu("CATEGORIES", "Back", []menuEntry{
+        {"Browse catalog", s.browseCatalog},
+        {"Add category", s.addCategory},
+        {"Rename or move category", s.editCategory},
+        {"Delete category", s.deleteCategory},
+        {"Set product categories", s.setProductCategories},
+    })
+}
+
+func (s *shop) customersMenu() {
+    s.runMenu("CUSTOMERS", "Back", []menuEntry{
+        {"List customers", s.listCustomers},
+        {"Add customer", s.addCustomer},
+        {"View customer", s.viewCustomer},
+        {"Edit customer", s.editCustomer},
+        {"Delete customer", s.deleteCustomer},
+        {"Merge duplicate customers", s.mergeCustomers},
+        {"Review phone conflicts", s.phoneConflicts},
+        {"Archive customer", func() { s.setArchived("customers", "customer", true) }},
+        {"Restore archived customer", func() { s.setArchived("customers", "customer", false) }},
+    })
+}
+
+func (s *shop) ordersMenu() {
+    s.runMenu("ORDERS", "Back", []menuEntry{
+        {"Create order", s.createOrder},
+        {"View orders", s.viewOrders},
+        {"View order", s.viewOrder},
+        {"Change order status", s.changeOrderStatus},
+        {"Cancel order", s.cancelOrder},
+        {"Return items", s.returnItems},
+        {"Change order customer", s.editOrder},
+        {"Delete order", s.deleteOrder},
+        {"Active promotions", s.listPromotions},
+    })
+}
+
+func (s *shop) listProducts() {
+    if err := forEachPage(s.reader, s.baseURL+"/products", printProducts); err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func printProducts(products []models.Product) {
+    tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+    fmt.Fprintln(tw, "ID\tNAME\tPRICE\tSTOCK\tCREATED")
+    for _, p := range products {
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\n", p.ID, p.Name, p.Price, p.Stock, p.CreatedAt.Format(time.RFC3339))
+    }
+    tw.Flush()
+}
+
+func (s *shop) searchProducts() {
+    q := readLine(s.reader, "Search for: ")
+    if q == "" {
+        return
+    }
+    var matches []productMatch
+    if err := getJSON(s.baseURL+"/products/search?q="+url.QueryEscape(q), &matches); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    if len(matches) == 0 {
+        fmt.Println("No products found.")
+        return
+    }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+    fmt.Fprintln(tw, "ID\tNAME\tPRICE\tSTOCK")
+    for _, p := range matches {
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%d\n", p.ID, p.Highlight, p.Price, p.Stock)
+    }
+    tw.Flush()
+}
+
+func (s *shop) addProduct() {
+    name := readLine(s.reader, "Product name: ")
+    sku := readLine(s.reader, "SKU (optional): ")
+    barcode := readLine(s.reader, "Barcode (optional, scan or type): ")
+    price, _ := readMoney(s.reader, "Price: ")
+    stock, _ := readInt(s.reader, "Stock: ")
+    req := models.NewProduct{Name: name, SKU: sku, Barcode: barcode, Price: price, Stock: int(stock)}
+    if !checkRequest(req) {
+        return
+    }
+    var created models.Product
+    if err := sendJSON(http.MethodPost, s.baseURL+"/products", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Created product #%d\n", created.ID)
+}
+
+func (s *shop) updateStock() {
+    pid, ok := s.pickProduct("Product ID or search: ")
+    if !ok {
+        return
+    }
+    vid, ok := s.pickVariant(pid)
+    if !ok {
+        return
+    }
+    err := retryOnConflict(s.reader, "product", func() error {
+        var p models.Product
+        if err := getJSON(s.resourceURL("products", pid), &p); err != nil {
+            return err
+        }
+        var variants []models.Variant
+        if err := getJSON(s.resourceURL("products", pid)+"/variants", &variants); err != nil {
+            return err
+        }
+        for _, v := range variants {
+            if v.ID == vid {
+                fmt.Printf("%s %s: %d in stock\n", p.Name, variantLabel(v), v.Stock)
             }
-            for _, o := range orders {
-                fmt.Printf("Order #%d customer=%d created=%s\n", o.ID, o.CustomerID, o.CreatedAt.Format(time.RFC3339))
-                for _, it := range o.Items {
-                    fmt.Printf("  item #%d product=%d qty=%d price=%.2f\n", it.ID, it.ProductID, it.Qty, it.PriceEach)
-                }
+        }
+        stock, _ := readInt(s.reader, "Counted stock: ")
+        note := readLine(s.reader, "Note (optional): ")
+        req := map[string]any{
+            "variant_id": vid,
+            "stock":      stock,
+            "note":       note,
+        }
+        var updated models.Product
+        if err := sendJSON(http.MethodPatch, s.resourceURL("products", pid)+"/stock", req, &updated, withIfMatch(p.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Updated product #%d stock=%d\n", updated.ID, updated.Stock)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+var adjustmentReasons = []models.MovementReason{
+    models.MovementRestock,
+    models.MovementShrinkage,
+    models.MovementCorrection,
+}
+
+func (s *shop) adjustStock() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    vid, ok := s.pickVariant(pid)
+    if !ok {
+        return
+    }
+    delta, _ := readInt(s.reader, "Change in stock (e.g. 12 or -3): ")
+    fmt.Println("Reason:")
+    for i, r := range adjustmentReasons {
+        fmt.Printf("  %d) %s\n", i+1, r)
+    }
+    pick, _ := readInt(s.reader, "> ")
+    if pick < 1 || int(pick) > len(adjustmentReasons) {
+        fmt.Println("Invalid choice")
+        return
+    }
+    note := readLine(s.reader, "Note (optional): ")
+    req := models.StockAdjustment{
+        VariantID: &vid,
+        Delta:     int(delta),
+        Reason:    adjustmentReasons[pick-1],
+        Note:      note,
+    }
+    if !checkRequest(req) {
+        return
+    }
+    var m models.InventoryMovement
+    if err := sendJSON(http.MethodPost, s.resourceURL("products", pid)+"/stock/adjustments", req, &m); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Recorded %s of %+d for product #%d; stock is now %d\n", m.Reason, m.Delta, m.ProductID, m.StockAfter)
+}
+
+func (s *shop) stockHistory() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    err := forEachPage(s.reader, s.resourceURL("products", pid)+"/movements", func(movements []models.InventoryMovement) {
+        tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+        fmt.Fprintln(tw, "WHEN\tCHANGE\tSTOCK\tREASON\tORDER\tBY\tNOTE")
+        for _, m := range movements {
+            order := ""
+            if m.OrderID != nil {
+                order = "#" + strconv.FormatInt(*m.OrderID, 10)
             }
-        case "0":
-            return
-        default:
-            fmt.Println("Invalid choice")
+            fmt.Fprintf(tw, "%s\t%+d\t%d\t%s\t%s\t%s\t%s\n", m.CreatedAt.Format(time.RFC3339), m.Delta, m.StockAfter, m.Reason, order, m.Actor, m.Note)
         }
+        tw.Flush()
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
     }
 }
 
-func main() {
-	_ = env.Load(".env")
-	baseURL := os.Getenv("SERVER_URL")
-    if baseURL == "" {
-        baseURL = "http://localhost:8080"
+func (s *shop) viewProduct() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    var p models.Product
+    if err := getJSON(s.resourceURL("products", pid), &p); err != nil {
+        fmt.Println("Error:", err)
+        return
     }
+    fmt.Printf("Product #%d %s price=%s stock=%d created=%s\n", p.ID, p.Name, p.Price, p.Stock, p.CreatedAt.Format(time.RFC3339))
+    if p.SKU != "" || p.Barcode != "" {
+        fmt.Printf("  sku=%s barcode=%s\n", p.SKU, p.Barcode)
+    }
+    printArchived(p.ArchivedAt)
+}
 
-    if !serverUp(baseURL) {
-        fmt.Println("Server still not reachable.")
+func (s *shop) priceHistory() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    var prices []models.ProductPrice
+    if err := getJSON(s.resourceURL("products", pid)+"/prices", &prices); err != nil {
+        fmt.Println("Error:", err)
         return
     }
+    now := time.Now()
+    tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+    fmt.Fprintln(tw, "FROM\tUNTIL\tPRICE\tSTATUS")
+    for _, pp := range prices {
+        until, mark := "", ""
+        if pp.EffectiveTo != nil {
+            until = pp.EffectiveTo.Local().Format(time.DateTime)
+        }
+        switch {
+        case pp.EffectiveFrom.After(now):
+            mark = "scheduled"
+        case pp.EffectiveTo == nil || pp.EffectiveTo.After(now):
+            mark = "current"
+        }
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", pp.EffectiveFrom.Local().Format(time.DateTime), until, pp.Price, mark)
+    }
+    tw.Flush()
+}
+
+// readTime reads a local date, optionally with a time of day. Blank input
+// returns nil.
+func readTime(reader *bufio.Reader, prompt string) *time.Time {
+    for {
+        text := readLine(reader, prompt)
+        if text == "" {
+            return nil
+        }
+        for _, layout := range []string{time.DateTime, "2006-01-02 15:04", time.DateOnly} {
+            if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+                return &t
+            }
+        }
+        fmt.Println("Please enter a date such as 2024-06-01 or 2024-06-01 09:00.")
+    }
+}
 
-    menu(baseURL)
+func (s *shop) schedulePrice() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    err := retryOnConflict(s.reader, "product", func() error {
+        var p models.Product
+        if err := getJSON(s.resourceURL("products", pid), &p); err != nil {
+            return err
+        }
+        fmt.Printf("%s sells for %s\n", p.Name, p.Price)
+        price, _ := readMoney(s.reader, "New price: ")
+        req := map[string]any{"price": price}
+        if from := readTime(s.reader, "Effective from (Enter for now): "); from != nil {
+            req["effective_from"] = from
+        }
+        if to := readTime(s.reader, "Until (Enter for no end): "); to != nil {
+            req["effective_to"] = to
+        }
+        var pp models.ProductPrice
+        if err := sendJSON(http.MethodPost, s.resourceURL("products", pid)+"/prices", req, &pp, withIfMatch(p.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Product #%d sells for %s from %s", pid, pp.Price, pp.EffectiveFrom.Local().Format(time.DateTime))
+        if pp.EffectiveTo != nil {
+            fmt.Printf(" until %s", pp.EffectiveTo.Local().Format(time.DateTime))
+        }
+        fmt.Println()
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+// variantLabel describes a variant by its options, e.g. "Color=Red Size=L".
+func variantLabel(v models.Variant) string {
+    if len(v.Options) == 0 {
+        return "(standard)"
+    }
+    names := make([]string, 0, len(v.Options))
+    for name := range v.Options {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    parts := make([]string, len(names))
+    for i, name := range names {
+        parts[i] = name + "=" + v.Options[name]
+    }
+    return strings.Join(parts, " ")
+}
+
+// pickVariant returns the variant of a product to sell or count. A product
+// with a single variant needs no choice; otherwise its variants are offered
+// as a numbered list.
+func (s *shop) pickVariant(pid int64) (int64, bool) {
+    var variants []models.Variant
+    if err := getJSON(s.resourceURL("products", pid)+"/variants", &variants); err != nil {
+        fmt.Println("Error:", err)
+        return 0, false
+    }
+    if len(variants) == 1 {
+        return variants[0].ID, true
+    }
+    for i, v := range variants {
+        fmt.Printf("  %d) %s  %s  (%d in stock)\n", i+1, variantLabel(v), v.UnitPrice, v.Stock)
+    }
+    n, _ := readInt(s.reader, "Variant: ")
+    if n < 1 || int(n) > len(variants) {
+        fmt.Println("Invalid choice")
+        return 0, false
+    }
+    return variants[n-1].ID, true
+}
+
+func (s *shop) listVariants() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    var variants []models.Variant
+    if err := getJSON(s.resourceURL("products", pid)+"/variants", &variants); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+    fmt.Fprintln(tw, "ID\tOPTIONS\tSKU\tPRICE\tSTOCK")
+    for _, v := range variants {
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\n", v.ID, variantLabel(v), v.SKU, v.UnitPrice, v.Stock)
+    }
+    tw.Flush()
+}
+
+func (s *shop) addOption() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    name := readLine(s.reader, "Option name (e.g. Color): ")
+    var values []string
+    for _, v := range strings.Split(readLine(s.reader, "Values, comma separated: "), ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            values = append(values, v)
+        }
+    }
+    req := map[string]any{"name": name, "values": values}
+    var created models.ProductOption
+    if err := sendJSON(http.MethodPost, s.resourceURL("products", pid)+"/options", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Added option %s with %d values\n", created.Name, len(created.Values))
+}
+
+func (s *shop) addVariant() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    var options []models.ProductOption
+    if err := getJSON(s.resourceURL("products", pid)+"/options", &options); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    if len(options) == 0 {
+        fmt.Println("Add an option such as Color or Size to the product first.")
+        return
+    }
+    chosen := map[string]string{}
+    for _, opt := range options {
+        values := make([]string, len(opt.Values))
+        for i, v := range opt.Values {
+            values[i] = v.Value
+        }
+        if len(values) == 0 {
+            fmt.Printf("Option %s has no values yet; add one first.\n", opt.Name)
+            return
+        }
+        // A variant has exactly one value of every option.
+        for {
+            value := readLine(s.reader, fmt.Sprintf("%s (%s): ", opt.Name, strings.Join(values, ", ")))
+            if slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) }) {
+                chosen[opt.Name] = value
+                break
+            }
+            fmt.Printf("Please pick one of: %s.\n", strings.Join(values, ", "))
+        }
+    }
+    req := map[string]any{"options": chosen}
+    if sku := readLine(s.reader, "SKU (optional): "); sku != "" {
+        req["sku"] = sku
+    }
+    for {
+        text := readLine(s.reader, "Price (Enter for the product's price): ")
+        if text == "" {
+            break
+        }
+        price, err := models.ParseMoney(text)
+        if err != nil {
+            fmt.Println("Please enter a valid amount, e.g. 12.50.")
+            continue
+        }
+        req["price"] = price
+        break
+    }
+    stock, _ := readInt(s.reader, "Stock: ")
+    req["stock"] = stock
+    var created models.Variant
+    if err := sendJSON(http.MethodPost, s.resourceURL("products", pid)+"/variants", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Created variant #%d %s price=%s stock=%d\n", created.ID, variantLabel(created), created.UnitPrice, created.Stock)
+}
+
+func (s *shop) editProduct() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    err := retryOnConflict(s.reader, "product", func() error {
+        var p models.Product
+        if err := getJSON(s.resourceURL("products", pid), &p); err != nil {
+            return err
+        }
+        req := map[string]any{}
+        if name := readDefault(s.reader, "Name", p.Name); name != p.Name {
+            req["name"] = name
+        }
+        // A single "-" clears an optional code.
+        codes := []struct{ field, label, current string }{
+            {"sku", "SKU", p.SKU},
+            {"barcode", "Barcode", p.Barcode},
+        }
+        for _, code := range codes {
+            text := readDefault(s.reader, code.label+" (- to clear)", code.current)
+            if text == "-" {
+                text = ""
+            }
+            if text != code.current {
+                req[code.field] = text
+            }
+        }
+        for {
+            text := readDefault(s.reader, "Price", p.Price.String())
+            price, err := models.ParseMoney(text)
+            if err != nil {
+                fmt.Println("Please enter a valid amount, e.g. 12.50.")
+                continue
+            }
+            if price != p.Price {
+                req["price"] = price
+            }
+            break
+        }
+        if len(req) == 0 {
+            fmt.Println("Nothing changed.")
+            return nil
+        }
+        var updated models.Product
+        if err := sendJSON(http.MethodPatch, s.resourceURL("products", pid), req, &updated, withIfMatch(p.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Updated product #%d %s price=%s\n", updated.ID, updated.Name, updated.Price)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func (s *shop) deleteProduct() {
+    pid, _ := readInt(s.reader, "Product ID: ")
+    err := retryOnConflict(s.reader, "product", func() error {
+        var p models.Product
+        if err := getJSON(s.resourceURL("products", pid), &p); err != nil {
+            return err
+        }
+        if !confirm(s.reader, fmt.Sprintf("Delete %s?", p.Name)) {
+            return nil
+        }
+        if err := sendJSON[any](http.MethodDelete, s.resourceURL("products", pid), nil, nil, withIfMatch(p.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Deleted product #%d\n", pid)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func printArchived(at *time.Time) {
+    if at != nil {
+        fmt.Printf("  archived %s\n", at.Format(time.RFC3339))
+    }
+}
+
+// setArchived archives or restores a product or customer. Archived records
+// are hidden from lists and cannot be used in new orders.
+func (s *shop) setArchived(kind, what string, archive bool) {
+    id, _ := readInt(s.reader, strings.ToUpper(what[:1])+what[1:]+" ID: ")
+    action := "unarchive"
+    if archive {
+        action = "archive"
+    }
+    type record struct {
+        ID      int64 `json:"id"`
+        Version int   `json:"version"`
+    }
+    err := retryOnConflict(s.reader, what, func() error {
+        var current, out record
+        if err := getJSON(s.resourceURL(kind, id), &current); err != nil {
+            return err
+        }
+        if err := sendJSON(http.MethodPost, s.resourceURL(kind, id)+"/"+action, nil, &out, withIfMatch(current.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("%sd %s #%d\n", strings.ToUpper(action[:1])+action[1:], what, out.ID)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+// browseCatalog walks the category tree from the top. Listing the products
+// of a category includes those of every category below it.
+func (s *shop) browseCatalog() {
+    var path []models.Category
+    for {
+        parentID := int64(0)
+        title := "Catalog"
+        if len(path) > 0 {
+            current := path[len(path)-1]
+            parentID = current.ID
+            names := make([]string, len(path))
+            for i, cat := range path {
+                names[i] = cat.Name
+            }
+            title += " > " + strings.Join(names, " > ")
+        }
+        var children []models.Category
+        if err := getJSON(s.baseURL+"/categories?parent_id="+strconv.FormatInt(parentID, 10), &children); err != nil {
+            fmt.Println("Error:", err)
+            return
+        }
+        fmt.Println()
+        fmt.Println(title)
+        for i, cat := range children {
+            fmt.Printf("  %d) %s\n", i+1, cat.Name)
+        }
+        prompt := "Number to open, Enter to leave: "
+        if len(path) > 0 {
+            prompt = "Number to open, p for products, b to go back, Enter to leave: "
+        }
+        choice := strings.ToLower(readLine(s.reader, prompt))
+        switch {
+        case choice == "":
+            return
+        case choice == "b" && len(path) > 0:
+            path = path[:len(path)-1]
+        case choice == "p" && len(path) > 0:
+            listURL := s.baseURL + "/products?category=" + strconv.FormatInt(parentID, 10)
+            if err := forEachPage(s.reader, listURL, printProducts); err != nil {
+                fmt.Println("Error:", err)
+            }
+        default:
+            n, err := strconv.Atoi(choice)
+            if err != nil || n < 1 || n > len(children) {
+                fmt.Println("Invalid choice.")
+                continue
+            }
+            path = append(path, children[n-1])
+        }
+    }
+}
+
+func (s *shop) addCategory() {
+    name := readLine(s.reader, "Category name: ")
+    req := map[string]any{"name": name}
+    if parent := readLine(s.reader, "Parent category ID (blank for top level): "); parent != "" {
+        id, err := strconv.ParseInt(parent, 10, 64)
+        if err != nil {
+            fmt.Println("Invalid category id.")
+            return
+        }
+        req["parent_id"] = id
+    }
+    var created models.Category
+    if err := sendJSON(http.MethodPost, s.baseURL+"/categories", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Created category #%d\n", created.ID)
+}
+
+func (s *shop) editCategory() {
+    id, _ := readInt(s.reader, "Category ID: ")
+    var cat models.Category
+    if err := getJSON(s.resourceURL("categories", id), &cat); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    req := map[string]any{}
+    if name := readDefault(s.reader, "Name", cat.Name); name != cat.Name {
+        req["name"] = name
+    }
+    parent := "0"
+    if cat.ParentID != nil {
+        parent = strconv.FormatInt(*cat.ParentID, 10)
+    }
+    if text := readDefault(s.reader, "Parent category ID (0 for top level)", parent); text != parent {
+        id, err := strconv.ParseInt(text, 10, 64)
+        if err != nil {
+            fmt.Println("Invalid category id.")
+            return
+        }
+        req["parent_id"] = id
+    }
+    if len(req) == 0 {
+        fmt.Println("Nothing changed.")
+        return
+    }
+    var updated models.Category
+    if err := sendJSON(http.MethodPatch, s.resourceURL("categories", id), req, &updated); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Updated category #%d %s\n", updated.ID, updated.Name)
+}
+
+func (s *shop) deleteCategory() {
+    id, _ := readInt(s.reader, "Category ID: ")
+    var cat models.Category
+    if err := getJSON(s.resourceURL("categories", id), &cat); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    if !confirm(s.reader, fmt.Sprintf("Delete category %s?", cat.Name)) {
+        return
+    }
+    if err := sendJSON[any](http.MethodDelete, s.resourceURL("categories", id), nil, nil); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Deleted category #%d\n", id)
+}
+
+func (s *shop) setProductCategories() {
+    pid, ok := s.pickProduct("Product ID or search: ")
+    if !ok {
+        return
+    }
+    var current []models.Category
+    if err := getJSON(s.resourceURL("products", pid)+"/categories", &current); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    ids := make([]string, len(current))
+    for i, cat := range current {
+        ids[i] = strconv.FormatInt(cat.ID, 10)
+    }
+    text := readDefault(s.reader, "Category IDs, comma separated (- for none)", strings.Join(ids, ","))
+    categoryIDs := make([]int64, 0)
+    if text != "-" && text != "" {
+        for _, part := range strings.Split(text, ",") {
+            id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+            if err != nil {
+                fmt.Println("Invalid category id:", part)
+                return
+            }
+            categoryIDs = append(categoryIDs, id)
+        }
+    }
+    var updated []models.Category
+    req := map[string]any{"category_ids": categoryIDs}
+    if err := sendJSON(http.MethodPut, s.resourceURL("products", pid)+"/categories", req, &updated); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    names := make([]string, len(updated))
+    for i, cat := range updated {
+        names[i] = cat.Name
+    }
+    fmt.Printf("Product #%d is in: %s\n", pid, strings.Join(names, ", "))
+}
+
+func (s *shop) listCustomers() {
+    err := forEachPage(s.reader, s.baseURL+"/customers", func(customers []models.Customer) {
+        tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+        fmt.Fprintln(tw, "ID\tNAME\tPHONE\tCREATED")
+        for _, c := range customers {
+            fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", c.ID, c.Name, c.Phone, c.CreatedAt.Format(time.RFC3339))
+        }
+        tw.Flush()
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func (s *shop) addCustomer() {
+    name := readLine(s.reader, "Customer name: ")
+    phone := readLine(s.reader, "Phone (optional): ")
+    req := models.NewCustomer{Name: name, Phone: phone}
+    if !checkRequest(req) {
+        return
+    }
+    var created models.Customer
+    if err := sendJSON(http.MethodPost, s.baseURL+"/customers", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Created customer #%d\n", created.ID)
+}
+
+func (s *shop) viewCustomer() {
+    cid, _ := readInt(s.reader, "Customer ID: ")
+    var cu models.Customer
+    if err := getJSON(s.resourceURL("customers", cid), &cu); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Customer #%d %s phone=%s created=%s\n", cu.ID, cu.Name, cu.Phone, cu.CreatedAt.Format(time.RFC3339))
+    printArchived(cu.ArchivedAt)
+}
+
+func (s *shop) editCustomer() {
+    cid, _ := readInt(s.reader, "Customer ID: ")
+    err := retryOnConflict(s.reader, "customer", func() error {
+        var cu models.Customer
+        if err := getJSON(s.resourceURL("customers", cid), &cu); err != nil {
+            return err
+        }
+        req := map[string]any{}
+        if name := readDefault(s.reader, "Name", cu.Name); name != cu.Name {
+            req["name"] = name
+        }
+        if phone := readDefault(s.reader, "Phone", cu.Phone); phone != cu.Phone {
+            req["phone"] = phone
+        }
+        if len(req) == 0 {
+            fmt.Println("Nothing changed.")
+            return nil
+        }
+        var updated models.Customer
+        if err := sendJSON(http.MethodPatch, s.resourceURL("customers", cid), req, &updated, withIfMatch(cu.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Updated customer #%d %s phone=%s\n", updated.ID, updated.Name, updated.Phone)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func (s *shop) deleteCustomer() {
+    cid, _ := readInt(s.reader, "Customer ID: ")
+    err := retryOnConflict(s.reader, "customer", func() error {
+        var cu models.Customer
+        if err := getJSON(s.resourceURL("customers", cid), &cu); err != nil {
+            return err
+        }
+        if !confirm(s.reader, fmt.Sprintf("Delete %s?", cu.Name)) {
+            return nil
+        }
+        if err := sendJSON[any](http.MethodDelete, s.resourceURL("customers", cid), nil, nil, withIfMatch(cu.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Deleted customer #%d\n", cid)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+// mergeCustomers moves the orders of a duplicate customer record to the one
+// that is kept and deletes the duplicate.
+func (s *shop) mergeCustomers() {
+    keepID, _ := readInt(s.reader, "Customer ID to keep: ")
+    dupID, _ := readInt(s.reader, "Duplicate customer ID: ")
+    err := retryOnConflict(s.reader, "customer", func() error {
+        var keep, dup models.Customer
+        if err := getJSON(s.resourceURL("customers", keepID), &keep); err != nil {
+            return err
+        }
+        if err := getJSON(s.resourceURL("customers", dupID), &dup); err != nil {
+            return err
+        }
+        if !confirm(s.reader, fmt.Sprintf("Merge #%d %s into #%d %s?", dup.ID, dup.Name, keep.ID, keep.Name)) {
+            return nil
+        }
+        var merged models.Customer
+        req := map[string]any{"duplicate_id": dupID, "duplicate_version": dup.Version}
+        if err := sendJSON(http.MethodPost, s.resourceURL("customers", keepID)+"/merge", req, &merged, withIfMatch(keep.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Merged customer #%d into #%d\n", dupID, merged.ID)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+// phoneConflicts lists the phone numbers set aside when phones were moved to
+// E.164 form. Fixing the customer's phone or merging the duplicate clears
+// an entry; the rest can be dismissed once dealt with.
+func (s *shop) phoneConflicts() {
+    var conflicts []models.PhoneConflict
+    if err := getJSON(s.baseURL+"/customers/phone-conflicts", &conflicts); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    if len(conflicts) == 0 {
+        fmt.Println("No phone conflicts.")
+        return
+    }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+    fmt.Fprintln(tw, "ID\tCUSTOMER\tORIGINAL PHONE\tPROBLEM")
+    for _, pc := range conflicts {
+        problem := "not a phone number"
+        if pc.DuplicateOf != nil {
+            problem = fmt.Sprintf("same number as customer #%d", *pc.DuplicateOf)
+        }
+        fmt.Fprintf(tw, "%d\t#%d %s\t%s\t%s\n", pc.ID, pc.CustomerID, pc.CustomerName, pc.RawPhone, problem)
+    }
+    tw.Flush()
+    id, err := strconv.ParseInt(readLine(s.reader, "Conflict ID to dismiss (Enter to go back): "), 10, 64)
+    if err != nil {
+        return
+    }
+    if err := sendJSON[any](http.MethodDelete, s.baseURL+"/customers/phone-conflicts/"+strconv.FormatInt(id, 10), nil, nil); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Dismissed phone conflict #%d\n", id)
+}
+
+// productMatch is one result of GET /products/search.
+type productMatch struct {
+    models.Product
+    Highlight string `json:"highlight"`
+}
+
+// pickMatch runs the search at path for q and lets the user choose one of
+// the results from a numbered list. It reports false when nothing matched
+// or nothing was chosen.
+func pickMatch[T any](s *shop, path, q string, show func(T) (int64, string)) (int64, bool) {
+    var matches []T
+    if err := getJSON(s.baseURL+path+"?q="+url.QueryEscape(q), &matches); err != nil {
+        fmt.Println("Error:", err)
+        return 0, false
+    }
+    if len(matches) == 0 {
+        fmt.Println("Nothing matches. Try again or press Enter to cancel.")
+        return 0, false
+    }
+    ids := make([]int64, len(matches))
+    for i, m := range matches {
+        id, label := show(m)
+        ids[i] = id
+        fmt.Printf("  %d) #%d %s\n", i+1, id, label)
+    }
+    choice := readLine(s.reader, "Pick a number (Enter to search again): ")
+    n, err := strconv.Atoi(choice)
+    if err != nil || n < 1 || n > len(ids) {
+        return 0, false
+    }
+    return ids[n-1], true
+}
+
+// pickCustomer asks for a customer by ID, name or phone. Anything that is
+// not an ID is searched for and the matches are offered as a numbered list.
+// Numbers of seven or more digits are taken as phone numbers, not IDs.
+func (s *shop) pickCustomer() (int64, bool) {
+    for {
+        text := readLine(s.reader, "Customer (ID, name or phone): ")
+        if text == "" {
+            return 0, false
+        }
+        if id, err := strconv.ParseInt(text, 10, 64); err == nil && len(text) < 7 {
+            return id, true
+        }
+        id, ok := pickMatch(s, "/customers/search", text, func(cu models.Customer) (int64, string) {
+            return cu.ID, cu.Name + " " + cu.Phone
+        })
+        if ok {
+            return id, true
+        }
+    }
+}
+
+// pickProduct asks for a product by ID or by a search term, offering the
+// matches as a numbered list. Blank input returns false.
+func (s *shop) pickProduct(prompt string) (int64, bool) {
+    for {
+        text := readLine(s.reader, prompt)
+        if text == "" {
+            return 0, false
+        }
+        if id, ok := s.findProduct(text); ok {
+            return id, true
+        }
+    }
+}
+
+// findProduct takes text as a product ID, or else searches for it and lets
+// the user pick from the matches.
+func (s *shop) findProduct(text string) (int64, bool) {
+    if id, err := strconv.ParseInt(text, 10, 64); err == nil {
+        return id, true
+    }
+    return pickMatch(s, "/products/search", text, func(p productMatch) (int64, string) {
+        return p.ID, fmt.Sprintf("%s  %s  (%d in stock)", p.Highlight, p.Price, p.Stock)
+    })
+}
+
+// addOrderItem adds qty of a product variant to the order, on the
+// variant's existing line if it has one, and returns the line's new
+// quantity.
+func addOrderItem(order *models.NewOrder, productID, variantID int64, qty int) int {
+    for i := range order.Items {
+        if order.Items[i].VariantID == variantID {
+            order.Items[i].Qty += qty
+            return order.Items[i].Qty
+        }
+    }
+    order.Items = append(order.Items, models.NewOrderItem{ProductID: productID, VariantID: variantID, Qty: qty})
+    return qty
+}
+
+func (s *shop) createOrder() {
+    cid, ok := s.pickCustomer()
+    if !ok {
+        return
+    }
+    req := models.NewOrder{CustomerID: cid}
+    // A barcode scanner types the code followed by Enter, so each scan adds
+    // one of that product without asking for a quantity.
+    fmt.Println("Scan barcodes, or enter a product ID or search term. Blank line to finish.")
+    for {
+        text := readLine(s.reader, "Product: ")
+        if text == "" {
+            break
+        }
+        if code, err := validate.NormalizeBarcode(text); err == nil {
+            var p models.Product
+            if err := getJSON(s.baseURL+"/products/by-barcode/"+code, &p); err != nil {
+                fmt.Println("Error:", err)
+                continue
+            }
+            vid, ok := s.pickVariant(p.ID)
+            if !ok {
+                continue
+            }
+            fmt.Printf("  %s x%d\n", p.Name, addOrderItem(&req, p.ID, vid, 1))
+            continue
+        }
+        pid, ok := s.findProduct(text)
+        if !ok {
+            continue
+        }
+        vid, ok := s.pickVariant(pid)
+        if !ok {
+            continue
+        }
+        qty, _ := readInt(s.reader, "Qty: ")
+        addOrderItem(&req, pid, vid, int(qty))
+    }
+    if !checkRequest(req) {
+        return
+    }
+    req.CouponCode = s.readCoupon(cid)
+    // The same key is sent on every retry of this order, so an attempt that
+    // timed out but did reach the server is not placed a second time.
+    key := newIdempotencyKey()
+    var created models.Order
+    for {
+        err := sendJSON(http.MethodPost, s.baseURL+"/orders", req, &created, withIdempotencyKey(key))
+        if err == nil {
+            break
+        }
+        fmt.Println("Error:", err)
+        if !isRetryable(err) || !confirm(s.reader, "Retry? The order will not be placed twice") {
+            return
+        }
+        if isKeyInUse(err) {
+            // Give the earlier attempt time to finish so the retry gets its
+            // response instead of another 409.
+            time.Sleep(2 * time.Second)
+        }
+    }
+    fmt.Printf("Created order #%d with %d items\n", created.ID, len(created.Items))
+    printDiscounts(created)
+    printOrderTotals(created)
+}
+
+// readCoupon asks for a coupon code and checks it for the customer, asking
+// again while the code cannot be used. Blank input means no coupon.
+func (s *shop) readCoupon(cid int64) string {
+    for {
+        code := readLine(s.reader, "Coupon code (Enter for none): ")
+        if code == "" {
+            return ""
+        }
+        var p models.Promotion
+        err := getJSON(s.baseURL+"/promotions/by-code/"+url.PathEscape(code)+"?customer_id="+strconv.FormatInt(cid, 10), &p)
+        if err == nil {
+            fmt.Printf("  %s\n", p.Name)
+            return code
+        }
+        fmt.Println("Error:", err)
+    }
+}
+
+func printDiscounts(o models.Order) {
+    for _, d := range o.Discounts {
+        fmt.Printf("  %s  -$%s\n", d.Description, d.Amount)
+    }
+}
+
+func (s *shop) listPromotions() {
+    var promotions []models.Promotion
+    if err := getJSON(s.baseURL+"/promotions?active=true", &promotions); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+    fmt.Fprintln(tw, "ID\tNAME\tCODE\tUSES\tENDS")
+    for _, p := range promotions {
+        code, ends, uses := p.Code, "", strconv.Itoa(p.Uses)
+        if code == "" {
+            code = "(automatic)"
+        }
+        if p.EndsAt != nil {
+            ends = p.EndsAt.Local().Format(time.DateTime)
+        }
+        if p.UsageLimit != nil {
+            uses += "/" + strconv.Itoa(*p.UsageLimit)
+        }
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", p.ID, p.Name, code, uses, ends)
+    }
+    tw.Flush()
+}
+
+func (s *shop) viewOrders() {
+    err := forEachPage(s.reader, s.baseURL+"/orders?sort=-id", func(orders []models.Order) {
+        for _, o := range orders {
+            printOrder(o)
+        }
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func (s *shop) viewOrder() {
+    oid, _ := readInt(s.reader, "Order ID: ")
+    var order models.Order
+    if err := getJSON(s.resourceURL("orders", oid), &order); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    printOrder(order)
+}
+
+func (s *shop) changeOrderStatus() {
+    oid, _ := readInt(s.reader, "Order ID: ")
+    orderURL := s.resourceURL("orders", oid)
+    var order models.Order
+    if err := getJSON(orderURL, &order); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    next := order.Status.Next()
+    if len(next) == 0 {
+        fmt.Printf("Order #%d is %s; no further changes allowed.\n", oid, order.Status)
+        return
+    }
+    fmt.Printf("Order #%d is %s. Move to:\n", oid, order.Status)
+    for i, st := range next {
+        fmt.Printf("  %d) %s\n", i+1, st)
+    }
+    pick, _ := readInt(s.reader, "> ")
+    if pick < 1 || int(pick) > len(next) {
+        fmt.Println("Invalid choice")
+        return
+    }
+    note := readLine(s.reader, "Note (optional): ")
+    req := map[string]any{
+        "status": next[pick-1],
+        "note":   note,
+    }
+    var updated models.Order
+    if err := sendJSON(http.MethodPost, orderURL+"/transitions", req, &updated); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Order #%d is now %s\n", updated.ID, updated.Status)
+}
+
+func (s *shop) cancelOrder() {
+    oid, _ := readInt(s.reader, "Order ID: ")
+    if !confirm(s.reader, "Cancel and restock this order?") {
+        return
+    }
+    note := readLine(s.reader, "Reason (optional): ")
+    req := map[string]any{
+        "note": note,
+    }
+    var cancelled models.Order
+    if err := sendJSON(http.MethodPost, s.resourceURL("orders", oid)+"/cancel", req, &cancelled); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Cancelled order #%d; %d items returned to stock\n", cancelled.ID, len(cancelled.Items))
+}
+
+func (s *shop) returnItems() {
+    oid, _ := readInt(s.reader, "Order ID: ")
+    orderURL := s.resourceURL("orders", oid)
+    var order models.Order
+    if err := getJSON(orderURL, &order); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    if !order.Status.Returnable() {
+        fmt.Printf("Order #%d is %s; items cannot be returned.\n", order.ID, order.Status)
+        return
+    }
+    items := make([]models.NewReturnItem, 0)
+    for _, it := range order.Items {
+        remaining := it.Qty - it.ReturnedQty
+        if remaining <= 0 {
+            continue
+        }
+        for {
+            text := readLine(s.reader, fmt.Sprintf("Return qty for item #%d (product %d, bought %d, returnable %d) [0]: ", it.ID, it.ProductID, it.Qty, remaining))
+            if text == "" {
+                break
+            }
+            qty, err := strconv.Atoi(text)
+            if err != nil || qty < 0 || qty > remaining {
+                fmt.Printf("Please enter a number from 0 to %d.\n", remaining)
+                continue
+            }
+            if qty > 0 {
+                items = append(items, models.NewReturnItem{OrderItemID: it.ID, Qty: qty})
+            }
+            break
+        }
+    }
+    if len(items) == 0 {
+        fmt.Println("Nothing to return.")
+        return
+    }
+    restock := confirm(s.reader, "Put returned items back in stock?")
+    reason := readLine(s.reader, "Reason (optional): ")
+    req := models.NewReturn{Items: items, Restock: restock, Reason: reason}
+    if !checkRequest(req) {
+        return
+    }
+    var created models.Return
+    if err := sendJSON(http.MethodPost, orderURL+"/returns", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Recorded return #%d for order #%d (refund $%s)\n", created.ID, created.OrderID, created.RefundAmount)
+}
+
+func (s *shop) editOrder() {
+    oid, _ := readInt(s.reader, "Order ID: ")
+    err := retryOnConflict(s.reader, "order", func() error {
+        var o models.Order
+        if err := getJSON(s.resourceURL("orders", oid), &o); err != nil {
+            return err
+        }
+        fmt.Printf("Order #%d belongs to customer #%d (%s)\n", o.ID, o.CustomerID, o.Status)
+        cid, _ := readInt(s.reader, "New customer ID: ")
+        req := map[string]any{
+            "customer_id": cid,
+        }
+        var updated models.Order
+        if err := sendJSON(http.MethodPatch, s.resourceURL("orders", oid), req, &updated, withIfMatch(o.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Order #%d now belongs to customer #%d\n", updated.ID, updated.CustomerID)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func (s *shop) deleteOrder() {
+    oid, _ := readInt(s.reader, "Order ID: ")
+    err := retryOnConflict(s.reader, "order", func() error {
+        var o models.Order
+        if err := getJSON(s.resourceURL("orders", oid), &o); err != nil {
+            return err
+        }
+        if !confirm(s.reader, fmt.Sprintf("Delete %s order #%d permanently?", o.Status, o.ID)) {
+            return nil
+        }
+        if err := sendJSON[any](http.MethodDelete, s.resourceURL("orders", oid), nil, nil, withIfMatch(o.Version)); err != nil {
+            return err
+        }
+        fmt.Printf("Deleted order #%d\n", oid)
+        return nil
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+// whoami asks the server who the current credentials belong to.
+func (s *shop) whoami() error {
+    var me struct {
+        Name string `json:"name"`
+        Role string `json:"role"`
+    }
+    if err := getJSON(s.baseURL+"/auth/me", &me); err != nil {
+        return err
+    }
+    fmt.Printf("Logged in as %s (%s)\n", me.Name, me.Role)
+    return nil
+}
+
+// startSession picks up a cached login, falls back to API_KEY and otherwise
+// asks the user to log in.
+func (s *shop) startSession() bool {
+    if session = loadSession(); session != nil {
+        authToken = session.AccessToken
+        if err := s.whoami(); err == nil {
+            return true
+        }
+        session = nil
+        removeSession()
+    }
+    if authToken = os.Getenv("API_KEY"); authToken != "" {
+        err := s.whoami()
+        if err == nil {
+            return true
+        }
+        fmt.Println("API_KEY was rejected:", err)
+        authToken = ""
+    }
+    return s.login()
+}
+
+// login prompts for a username and password until the server accepts them
+// or the user gives up.
+func (s *shop) login() bool {
+    for {
+        username := readLine(s.reader, "Username (blank to quit): ")
+        if username == "" {
+            return false
+        }
+        password := readLine(s.reader, "Password: ")
+        req := map[string]any{
+            "username": username,
+            "password": password,
+        }
+        var t tokenResponse
+        if err := sendJSON(http.MethodPost, s.baseURL+"/auth/login", req, &t); err != nil {
+            fmt.Println("Error:", err)
+            continue
+        }
+        useSession(t)
+        fmt.Printf("Logged in as %s (%s)\n", t.User.Username, t.User.Role)
+        return true
+    }
+}
+
+// logout ends the server session and forgets the cached tokens.
+func (s *shop) logout() {
+    if session != nil {
+        if err := sendJSON[any](http.MethodPost, s.baseURL+"/auth/logout", nil, nil); err != nil {
+            fmt.Println("Error:", err)
+        }
+    }
+    session = nil
+    authToken = ""
+    removeSession()
+}
+
+func (s *shop) switchUser() {
+    s.logout()
+    if !s.login() {
+        os.Exit(0)
+    }
+}
+
+func (s *shop) changePassword() {
+    if session == nil {
+        fmt.Println("Log in as a staff user to change a password.")
+        return
+    }
+    current := readLine(s.reader, "Current password: ")
+    next := readLine(s.reader, "New password: ")
+    if readLine(s.reader, "Repeat new password: ") != next {
+        fmt.Println("Passwords do not match.")
+        return
+    }
+    req := models.PasswordChange{CurrentPassword: current, NewPassword: next}
+    if !checkRequest(req) {
+        return
+    }
+    if err := sendJSON[any](http.MethodPost, s.baseURL+"/auth/password", req, nil); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Println("Password changed. Other sessions of this user were logged out.")
+}
+
+func (s *shop) listUsers() {
+    err := forEachPage(s.reader, s.baseURL+"/admin/users", func(users []models.User) {
+        tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+        fmt.Fprintln(tw, "ID\tUSERNAME\tROLE\tCREATED")
+        for _, u := range users {
+            fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", u.ID, u.Username, u.Role, u.CreatedAt.Format(time.RFC3339))
+        }
+        tw.Flush()
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func (s *shop) addUser() {
+    username := readLine(s.reader, "Username: ")
+    password := readLine(s.reader, "Initial password (min 8 characters): ")
+    role := readLine(s.reader, "Role (admin/clerk/readonly): ")
+    req := models.NewUser{Username: username, Password: password, Role: models.Role(role)}
+    if !checkRequest(req) {
+        return
+    }
+    var created models.User
+    if err := sendJSON(http.MethodPost, s.baseURL+"/admin/users", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Created user #%d %s (%s)\n", created.ID, created.Username, created.Role)
+}
+
+func (s *shop) disableUser() {
+    id, _ := readInt(s.reader, "User ID: ")
+    if !confirm(s.reader, "Disable this user and end their sessions?") {
+        return
+    }
+    if err := sendJSON[any](http.MethodDelete, s.resourceURL("admin/users", id), nil, nil); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Disabled user #%d\n", id)
+}
+
+func (s *shop) listAPIKeys() {
+    err := forEachPage(s.reader, s.baseURL+"/admin/api-keys", func(keys []models.APIKey) {
+        tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+        fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tROLE\tCREATED")
+        for _, k := range keys {
+            fmt.Fprintf(tw, "%d\t%s\t%s…\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Role, k.CreatedAt.Format(time.RFC3339))
+        }
+        tw.Flush()
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func (s *shop) createAPIKey() {
+    name := readLine(s.reader, "Name (who or what uses the key): ")
+    role := readLine(s.reader, "Role (admin/clerk/readonly): ")
+    req := models.NewAPIKey{Name: name, Role: models.Role(role)}
+    if !checkRequest(req) {
+        return
+    }
+    var created struct {
+        models.APIKey
+        Key string `json:"key"`
+    }
+    if err := sendJSON(http.MethodPost, s.baseURL+"/admin/api-keys", req, &created); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Created API key #%d for %s (%s):\n  %s\n", created.ID, created.Name, created.Role, created.Key)
+    fmt.Println("Store it now; it cannot be shown again.")
+}
+
+func (s *shop) revokeAPIKey() {
+    id, _ := readInt(s.reader, "API key ID: ")
+    if !confirm(s.reader, "Revoke this API key?") {
+        return
+    }
+    if err := sendJSON[any](http.MethodDelete, s.resourceURL("admin/api-keys", id), nil, nil); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Revoked API key #%d\n", id)
+}
+
+// auditLog pages through the audit log, newest first, optionally narrowed
+// to one resource.
+func (s *shop) auditLog() {
+    url := s.baseURL + "/audit"
+    if kind := readLine(s.reader, "Resource type (product/customer/order/..., blank for all): "); kind != "" {
+        url += "?resource_type=" + kind
+        if id := readLine(s.reader, "Resource ID (blank for all): "); id != "" {
+            url += "&resource_id=" + id
+        }
+    }
+    err := forEachPage(s.reader, url, func(entries []models.AuditEntry) {
+        for _, e := range entries {
+            fmt.Printf("#%d %s %s (%s) %s %s #%d\n", e.ID, e.CreatedAt.Format(time.RFC3339), e.ActorName, e.ActorType, e.Action, e.ResourceType, e.ResourceID)
+            for _, line := range auditChanges(e.Before, e.After) {
+                fmt.Println("    " + line)
+            }
+        }
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+// auditChanges lists the top-level fields that differ between two
+// snapshots as "field: old -> new".
+func auditChanges(before, after json.RawMessage) []string {
+    var b, a map[string]json.RawMessage
+    json.Unmarshal(before, &b)
+    json.Unmarshal(after, &a)
+    fields := make(map[string]bool)
+    for k := range b {
+        fields[k] = true
+    }
+    for k := range a {
+        fields[k] = true
+    }
+    names := make([]string, 0, len(fields))
+    for k := range fields {
+        if k != "version" && !bytes.Equal(b[k], a[k]) {
+            names = append(names, k)
+        }
+    }
+    sort.Strings(names)
+    lines := make([]string, 0, len(names))
+    for _, k := range names {
+        old, cur := string(b[k]), string(a[k])
+        if old == "" {
+            old = "-"
+        }
+        if cur == "" {
+            cur = "-"
+        }
+        lines = append(lines, fmt.Sprintf("%s: %s -> %s", k, old, cur))
+    }
+    return lines
+}
+
+func main() {
+	_ = env.Load(".env")
+	baseURL := os.Getenv("SERVER_URL")
+    if baseURL == "" {
+        baseURL = "http://localhost:8080"
+    }
+
+    if !serverUp(baseURL) {
+        fmt.Println("Server still not reachable.")
+        return
+    }
+
+    s := &shop{reader: bufio.NewReader(os.Stdin), baseURL: baseURL}
+    if !s.startSession() {
+        return
+    }
+    s.mainMenu()
 }
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS returns (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  restocked BOOLEAN NOT NULL DEFAULT false,
+  refund_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+  reason TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS return_items (
+  id SERIAL PRIMARY KEY,
+  return_id INT NOT NULL REFERENCES returns(id) ON DELETE CASCADE,
+  order_item_id INT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+  qty INT NOT NULL CHECK (qty > 0),
+  refund_each NUMERIC(12,2) NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS returns_order_id_idx ON returns (order_id);
+CREATE INDEX IF NOT EXISTS return_items_order_item_id_idx ON return_items (order_item_id);
@@ -0,0 +1,15 @@
+ALTER TABLE order_items
+  ADD COLUMN IF NOT EXISTS line_total NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS subtotal NUMERIC(12,2) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS tax NUMERIC(12,2) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS discount NUMERIC(12,2) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS total NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+UPDATE order_items SET line_total = qty * price_each;
+
+UPDATE orders o
+SET subtotal = s.subtotal, total = s.subtotal
+FROM (SELECT order_id, SUM(line_total) AS subtotal FROM order_items GROUP BY order_id) s
+WHERE o.id = s.order_id;
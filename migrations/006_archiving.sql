@@ -0,0 +1,5 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS products_active_idx ON products (id) WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS customers_active_idx ON customers (id) WHERE archived_at IS NULL;
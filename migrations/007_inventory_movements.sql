@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS inventory_movements (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  delta INT NOT NULL CHECK (delta <> 0),
+  reason TEXT NOT NULL CHECK (reason IN ('sale', 'return', 'restock', 'shrinkage', 'correction')),
+  actor TEXT NOT NULL DEFAULT '',
+  note TEXT NOT NULL DEFAULT '',
+  -- Not a foreign key: the ledger outlives deleted orders.
+  order_id INT,
+  stock_after INT NOT NULL CHECK (stock_after >= 0),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS inventory_movements_product_id_idx ON inventory_movements (product_id, id);
+
+CREATE OR REPLACE FUNCTION inventory_movements_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'inventory_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS inventory_movements_no_update ON inventory_movements;
+CREATE TRIGGER inventory_movements_no_update
+  BEFORE UPDATE ON inventory_movements
+  FOR EACH ROW EXECUTE FUNCTION inventory_movements_append_only();
+
+-- Open the ledger with each product's current stock so that the running
+-- stock_after values line up with products.stock from here on.
+INSERT INTO inventory_movements (product_id, delta, reason, note, stock_after)
+SELECT p.id, p.stock, 'correction', 'opening balance', p.stock
+FROM products p
+WHERE p.stock > 0
+  AND NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.product_id = p.id);
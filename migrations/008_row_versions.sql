@@ -0,0 +1,30 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+-- Any change to a row, whichever endpoint makes it, moves it to a new
+-- version so stale If-Match preconditions are detected.
+CREATE OR REPLACE FUNCTION bump_row_version() RETURNS trigger AS $$
+BEGIN
+  NEW.version := OLD.version + 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS products_bump_version ON products;
+CREATE TRIGGER products_bump_version
+  BEFORE UPDATE ON products
+  FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*)
+  EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS customers_bump_version ON customers;
+CREATE TRIGGER customers_bump_version
+  BEFORE UPDATE ON customers
+  FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*)
+  EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS orders_bump_version ON orders;
+CREATE TRIGGER orders_bump_version
+  BEFORE UPDATE ON orders
+  FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*)
+  EXECUTE FUNCTION bump_row_version();
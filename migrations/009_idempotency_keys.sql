@@ -0,0 +1,16 @@
+-- Responses to POST requests sent with an Idempotency-Key header, so a
+-- retried request is answered with the original response instead of being
+-- applied twice. status and response stay NULL while the first request is
+-- still running.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key TEXT NOT NULL,
+  method TEXT NOT NULL,
+  path TEXT NOT NULL,
+  request_hash TEXT NOT NULL,
+  status INT,
+  response BYTEA,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (key, method, path)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
@@ -0,0 +1,12 @@
+-- Only a SHA-256 hash of each key is stored; the key itself is shown once
+-- when it is created. prefix keeps the first characters so keys can be told
+-- apart in listings.
+CREATE TABLE IF NOT EXISTS api_keys (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  role TEXT NOT NULL CHECK (role IN ('admin', 'clerk', 'readonly')),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  revoked_at TIMESTAMP
+);
@@ -0,0 +1,33 @@
+-- One row per change made through the API, written in the same transaction
+-- as the change. before and after hold the resource as the API returns it;
+-- before is NULL for creations and after is NULL for deletions.
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  request_id TEXT NOT NULL,
+  -- Not foreign keys: entries outlive the users and keys that made them.
+  actor_type TEXT NOT NULL CHECK (actor_type IN ('user', 'api_key')),
+  actor_id INT NOT NULL,
+  actor_name TEXT NOT NULL,
+  method TEXT NOT NULL,
+  route TEXT NOT NULL,
+  resource_type TEXT NOT NULL,
+  resource_id BIGINT NOT NULL,
+  action TEXT NOT NULL,
+  before JSONB,
+  after JSONB,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_resource_idx ON audit_log (resource_type, resource_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update
+  BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
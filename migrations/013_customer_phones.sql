@@ -0,0 +1,60 @@
+-- Phones are stored in E.164 form ("+15550101") so the same number always
+-- compares equal. Only numbers that pass the API's own phone check
+-- (validate.phonePattern) are normalized, the way validate.NormalizePhone
+-- does it: local numbers get the configured PHONE_COUNTRY_CODE, which the
+-- server passes in as app.phone_country_code.
+--
+-- A number that cannot be stored that way is not thrown away: its original
+-- text goes to customer_phone_conflicts, listed by GET
+-- /customers/phone-conflicts, until someone fixes the customer's phone or
+-- merges the duplicate away.
+CREATE TABLE IF NOT EXISTS customer_phone_conflicts (
+  id SERIAL PRIMARY KEY,
+  customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+  raw_phone TEXT NOT NULL,
+  -- The older customer that kept the number, or NULL when raw_phone could
+  -- not be read as a phone number at all.
+  duplicate_of INT REFERENCES customers(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS customer_phone_conflicts_customer_id_idx ON customer_phone_conflicts (customer_id);
+
+CREATE TEMP TABLE customer_phone_fixes AS
+SELECT id, raw_phone, CASE
+    WHEN btrim(raw_phone) !~ '^\+?[0-9][0-9 ().-]{5,18}[0-9]$' THEN NULL
+    WHEN btrim(raw_phone) LIKE '+%' THEN '+' || digits
+    WHEN digits LIKE '00%' THEN '+' || substr(digits, 3)
+    ELSE '+' || COALESCE(NULLIF(current_setting('app.phone_country_code', true), ''), '1') || ltrim(digits, '0')
+  END AS phone
+FROM (
+  SELECT id, phone AS raw_phone, regexp_replace(phone, '[^0-9]', '', 'g') AS digits
+  FROM customers
+  WHERE phone IS NOT NULL
+) c;
+
+UPDATE customer_phone_fixes SET phone = NULL WHERE phone !~ '^\+[1-9][0-9]{7,14}$';
+
+INSERT INTO customer_phone_conflicts (customer_id, raw_phone)
+SELECT id, raw_phone FROM customer_phone_fixes WHERE phone IS NULL AND btrim(raw_phone) <> '';
+
+-- Only the oldest customer keeps a shared number; the others are reported
+-- against it so they can be merged with POST /customers/:id/merge.
+INSERT INTO customer_phone_conflicts (customer_id, raw_phone, duplicate_of)
+SELECT f.id, f.raw_phone, (SELECT min(o.id) FROM customer_phone_fixes o WHERE o.phone = f.phone)
+FROM customer_phone_fixes f
+WHERE EXISTS (SELECT 1 FROM customer_phone_fixes o WHERE o.phone = f.phone AND o.id < f.id);
+
+UPDATE customer_phone_fixes f SET phone = NULL
+WHERE EXISTS (SELECT 1 FROM customer_phone_fixes o WHERE o.phone = f.phone AND o.id < f.id);
+
+UPDATE customers c SET phone = f.phone
+FROM customer_phone_fixes f
+WHERE f.id = c.id AND c.phone IS DISTINCT FROM f.phone;
+
+DROP TABLE customer_phone_fixes;
+
+ALTER TABLE customers DROP CONSTRAINT IF EXISTS customers_phone_e164;
+ALTER TABLE customers ADD CONSTRAINT customers_phone_e164 CHECK (phone ~ '^\+[1-9][0-9]{7,14}$');
+
+CREATE UNIQUE INDEX IF NOT EXISTS customers_phone_key ON customers (phone);
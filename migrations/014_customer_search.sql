@@ -0,0 +1,7 @@
+-- Trigram indexes back GET /customers/search: partial, case-insensitive
+-- name matches (ILIKE '%...%' and the % similarity operator) and partial
+-- phone matches.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS customers_name_trgm_idx ON customers USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS customers_phone_trgm_idx ON customers USING GIN (phone gin_trgm_ops);
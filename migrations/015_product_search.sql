@@ -0,0 +1,10 @@
+-- Full-text and trigram indexes back GET /products/search: whole words
+-- (with English stemming, so "mugs" finds "Ceramic Mug") plus partial and
+-- misspelled names.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search tsvector
+  GENERATED ALWAYS AS (to_tsvector('english', name)) STORED;
+
+CREATE INDEX IF NOT EXISTS products_search_idx ON products USING GIN (search);
+CREATE INDEX IF NOT EXISTS products_name_trgm_idx ON products USING GIN (name gin_trgm_ops);
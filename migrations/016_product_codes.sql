@@ -0,0 +1,11 @@
+-- Internal stock-keeping units and retail barcodes. Barcodes are stored as
+-- 13-digit EAN-13; a 12-digit UPC-A is kept with a leading zero, which is
+-- the same number as an EAN-13.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku TEXT;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS barcode TEXT;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_barcode_ean13;
+ALTER TABLE products ADD CONSTRAINT products_barcode_ean13 CHECK (barcode ~ '^[0-9]{13}$');
+
+CREATE UNIQUE INDEX IF NOT EXISTS products_sku_key ON products (sku);
+CREATE UNIQUE INDEX IF NOT EXISTS products_barcode_key ON products (barcode);
@@ -0,0 +1,20 @@
+-- Categories form a tree through parent_id; a product can sit in any
+-- number of them. Sibling names are unique regardless of case.
+CREATE TABLE IF NOT EXISTS categories (
+  id SERIAL PRIMARY KEY,
+  parent_id INT REFERENCES categories(id),
+  name TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  CHECK (parent_id <> id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS categories_sibling_name_key ON categories (COALESCE(parent_id, 0), lower(name));
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+
+CREATE TABLE IF NOT EXISTS product_categories (
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+  PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX IF NOT EXISTS product_categories_category_id_idx ON product_categories (category_id);
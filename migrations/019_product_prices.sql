@@ -0,0 +1,19 @@
+-- The price history of each product. An entry with no effective_to is the
+-- price from effective_from on; entries never overlap, so exactly one is in
+-- effect at any time since the product was created.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE IF NOT EXISTS product_prices (
+  id SERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  price NUMERIC(12,2) NOT NULL CHECK (price >= 0),
+  effective_from TIMESTAMPTZ NOT NULL,
+  effective_to TIMESTAMPTZ CHECK (effective_to > effective_from),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  EXCLUDE USING gist (product_id WITH =, tstzrange(effective_from, effective_to) WITH &&)
+);
+
+-- Today's prices have applied since each product was created.
+INSERT INTO product_prices (product_id, price, effective_from)
+SELECT p.id, p.price, p.created_at FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM product_prices pp WHERE pp.product_id = p.id);
@@ -0,0 +1,47 @@
+-- A promotion with a code is a coupon the customer has to present; one
+-- without a code applies to every order it fits. percent_off and
+-- amount_off come off the matching items, or the whole order when neither
+-- product_id nor category_id narrows it down; buy_x_get_y makes every
+-- get_qty cheapest matching units free for each buy_qty bought.
+CREATE TABLE IF NOT EXISTS promotions (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  code TEXT,
+  kind TEXT NOT NULL CHECK (kind IN ('percent_off', 'amount_off', 'buy_x_get_y')),
+  percent_off INT CHECK (percent_off BETWEEN 1 AND 100),
+  amount_off NUMERIC(12,2) CHECK (amount_off > 0),
+  buy_qty INT CHECK (buy_qty > 0),
+  get_qty INT CHECK (get_qty > 0),
+  product_id INT REFERENCES products(id),
+  category_id INT REFERENCES categories(id),
+  min_subtotal NUMERIC(12,2) NOT NULL DEFAULT 0 CHECK (min_subtotal >= 0),
+  starts_at TIMESTAMPTZ,
+  ends_at TIMESTAMPTZ CHECK (ends_at > starts_at),
+  usage_limit INT CHECK (usage_limit > 0),
+  per_customer_limit INT CHECK (per_customer_limit > 0),
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  version INT NOT NULL DEFAULT 1,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS promotions_code_key ON promotions (upper(code));
+
+DROP TRIGGER IF EXISTS promotions_bump_version ON promotions;
+CREATE TRIGGER promotions_bump_version
+  BEFORE UPDATE ON promotions
+  FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*)
+  EXECUTE FUNCTION bump_row_version();
+
+-- The discount lines of an order; orders.discount is their sum. A line
+-- counts as one use of its promotion unless the order is cancelled.
+CREATE TABLE IF NOT EXISTS order_discounts (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  promotion_id INT NOT NULL REFERENCES promotions(id),
+  code TEXT,
+  description TEXT NOT NULL,
+  amount NUMERIC(12,2) NOT NULL CHECK (amount > 0)
+);
+
+CREATE INDEX IF NOT EXISTS order_discounts_order_id_idx ON order_discounts (order_id);
+CREATE INDEX IF NOT EXISTS order_discounts_promotion_id_idx ON order_discounts (promotion_id);
@@ -0,0 +1,10 @@
+-- The ledger is history: deleting a product must not take its movements
+-- with it, and no movement may be deleted any more than edited.
+ALTER TABLE inventory_movements DROP CONSTRAINT IF EXISTS inventory_movements_product_id_fkey;
+ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_product_id_fkey
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE RESTRICT;
+
+DROP TRIGGER IF EXISTS inventory_movements_no_update ON inventory_movements;
+CREATE TRIGGER inventory_movements_no_update
+  BEFORE UPDATE OR DELETE ON inventory_movements
+  FOR EACH ROW EXECUTE FUNCTION inventory_movements_append_only();
@@ -0,0 +1,7 @@
+-- Keys are chosen by clients, so two callers may well pick the same one.
+-- Scope them to the user or API key that sent the request, and keep the
+-- response headers a replay has to repeat (ETag, Location).
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS actor TEXT NOT NULL DEFAULT '';
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD CONSTRAINT idempotency_keys_pkey PRIMARY KEY (actor, key, method, path);
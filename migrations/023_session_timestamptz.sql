@@ -0,0 +1,7 @@
+-- Session expiry is compared with NOW(), so store it as an absolute point
+-- in time rather than a wall-clock reading in some server's time zone.
+ALTER TABLE sessions
+  ALTER COLUMN access_expires_at TYPE TIMESTAMPTZ,
+  ALTER COLUMN refresh_expires_at TYPE TIMESTAMPTZ,
+  ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+  ALTER COLUMN revoked_at TYPE TIMESTAMPTZ;
@@ -0,0 +1,30 @@
+-- A SKU names one product or one variant, never both, so scanning it can
+-- only match one thing. Each table's unique index covers its own rows; this
+-- trigger covers the other table. The advisory lock makes a second writer
+-- of the same SKU wait until the first has committed and then see its row.
+CREATE OR REPLACE FUNCTION sku_unique_across_tables() RETURNS trigger AS $$
+BEGIN
+  IF NEW.sku IS NULL THEN
+    RETURN NEW;
+  END IF;
+  PERFORM pg_advisory_xact_lock(hashtext('sku:' || NEW.sku));
+  IF TG_TABLE_NAME = 'products' THEN
+    IF EXISTS (SELECT 1 FROM product_variants WHERE sku = NEW.sku) THEN
+      RAISE EXCEPTION 'SKU % is already used by a variant', NEW.sku USING ERRCODE = 'unique_violation';
+    END IF;
+  ELSIF EXISTS (SELECT 1 FROM products WHERE sku = NEW.sku) THEN
+    RAISE EXCEPTION 'SKU % is already used by a product', NEW.sku USING ERRCODE = 'unique_violation';
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS products_sku_unique ON products;
+CREATE TRIGGER products_sku_unique
+  BEFORE INSERT OR UPDATE OF sku ON products
+  FOR EACH ROW EXECUTE FUNCTION sku_unique_across_tables();
+
+DROP TRIGGER IF EXISTS product_variants_sku_unique ON product_variants;
+CREATE TRIGGER product_variants_sku_unique
+  BEFORE INSERT OR UPDATE OF sku ON product_variants
+  FOR EACH ROW EXECUTE FUNCTION sku_unique_across_tables();
@@ -0,0 +1,31 @@
+-- Each order line keeps its share of the order's discount and tax, so a
+-- return refunds what was actually paid for the units coming back.
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount NUMERIC(12,2) NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+-- Earlier orders share their discount and tax in proportion to their line
+-- totals. The largest line of each order takes the cents lost to rounding
+-- so the shares add up to the order's amounts.
+UPDATE order_items oi SET discount = round(o.discount * oi.line_total / o.subtotal, 2)
+FROM orders o
+WHERE o.id = oi.order_id AND o.subtotal > 0;
+
+UPDATE order_items oi SET tax = round(o.tax * (oi.line_total - oi.discount) / (o.subtotal - o.discount), 2)
+FROM orders o
+WHERE o.id = oi.order_id AND o.subtotal > o.discount;
+
+UPDATE order_items oi SET discount = oi.discount + d.discount_left, tax = oi.tax + d.tax_left
+FROM (
+  SELECT o.id AS order_id, o.discount - SUM(i.discount) AS discount_left, o.tax - SUM(i.tax) AS tax_left,
+         (SELECT l.id FROM order_items l WHERE l.order_id = o.id ORDER BY l.line_total DESC, l.id LIMIT 1) AS item_id
+  FROM orders o JOIN order_items i ON i.order_id = o.id
+  GROUP BY o.id
+) d
+WHERE oi.id = d.item_id AND (d.discount_left <> 0 OR d.tax_left <> 0);
+
+-- refund is the amount paid back for a returned line; refund_each alone
+-- cannot hold it exactly once discounts and tax are shared out.
+ALTER TABLE return_items ADD COLUMN IF NOT EXISTS refund NUMERIC(12,2);
+UPDATE return_items SET refund = refund_each * qty WHERE refund IS NULL;
+ALTER TABLE return_items ALTER COLUMN refund SET NOT NULL;
+ALTER TABLE return_items ALTER COLUMN refund SET DEFAULT 0;
@@ -0,0 +1,13 @@
+-- A product that was created by mistake may be deleted as long as nothing
+-- happened to its stock after it was created. Its initial stock entries go
+-- with it, so the ledger lets a transaction delete the movements of the one
+-- product it names in app.deleting_product; everything else stays
+-- append-only.
+CREATE OR REPLACE FUNCTION inventory_movements_append_only() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' AND OLD.product_id::text = current_setting('app.deleting_product', true) THEN
+    RETURN OLD;
+  END IF;
+  RAISE EXCEPTION 'inventory_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
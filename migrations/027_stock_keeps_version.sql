@@ -0,0 +1,23 @@
+-- Stock moves with every sale, so a till would make any edit based on a
+-- product or variant read a moment earlier fail its If-Match. Versions
+-- now only move when something other than stock changes. The check lives
+-- in the function rather than in WHEN because products has a generated
+-- column, which a BEFORE trigger's WHEN may not read from NEW.
+CREATE OR REPLACE FUNCTION bump_row_version_except_stock() RETURNS trigger AS $$
+BEGIN
+  IF to_jsonb(OLD) - 'stock' - 'search' IS DISTINCT FROM to_jsonb(NEW) - 'stock' - 'search' THEN
+    NEW.version := OLD.version + 1;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS products_bump_version ON products;
+CREATE TRIGGER products_bump_version
+  BEFORE UPDATE ON products
+  FOR EACH ROW EXECUTE FUNCTION bump_row_version_except_stock();
+
+DROP TRIGGER IF EXISTS product_variants_bump_version ON product_variants;
+CREATE TRIGGER product_variants_bump_version
+  BEFORE UPDATE ON product_variants
+  FOR EACH ROW EXECUTE FUNCTION bump_row_version_except_stock();
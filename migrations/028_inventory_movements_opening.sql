@@ -0,0 +1,29 @@
+-- The entry that stocks a new product or variant is marked as its opening
+-- entry by the server; the note is typed by clerks and proves nothing.
+-- Opening entries may be deleted together with their product while
+-- nothing else has happened to its stock, which replaces the
+-- app.deleting_product setting of 026.
+ALTER TABLE inventory_movements ADD COLUMN IF NOT EXISTS opening BOOLEAN NOT NULL DEFAULT false;
+
+-- Mark the entries written so far by the server itself: the opening
+-- balances of 007 and the first "initial stock" restock of each variant.
+-- The ledger is append-only, so its trigger is lifted for the backfill.
+ALTER TABLE inventory_movements DISABLE TRIGGER inventory_movements_no_update;
+UPDATE inventory_movements m SET opening = true
+WHERE ((m.reason = 'correction' AND m.note = 'opening balance')
+    OR (m.reason = 'restock' AND m.note = 'initial stock'))
+  AND m.actor = ''
+  AND m.id = (SELECT min(f.id) FROM inventory_movements f
+              WHERE f.product_id = m.product_id AND f.variant_id IS NOT DISTINCT FROM m.variant_id);
+ALTER TABLE inventory_movements ENABLE TRIGGER inventory_movements_no_update;
+
+CREATE OR REPLACE FUNCTION inventory_movements_append_only() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' AND OLD.opening AND NOT EXISTS (
+    SELECT 1 FROM inventory_movements m WHERE m.product_id = OLD.product_id AND NOT m.opening
+  ) THEN
+    RETURN OLD;
+  END IF;
+  RAISE EXCEPTION 'inventory_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
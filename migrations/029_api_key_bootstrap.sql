@@ -0,0 +1,12 @@
+-- The key registered from ADMIN_API_KEY is marked as the bootstrap key, so
+-- the server can revoke it when the setting changes without touching keys
+-- that an admin happened to name "bootstrap". Keys created through the API
+-- have an audit entry; the earlier bootstrap keys do not.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS bootstrap BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE api_keys k SET bootstrap = true
+WHERE k.name = 'bootstrap'
+  AND NOT EXISTS (
+    SELECT 1 FROM audit_log a
+    WHERE a.resource_type = 'api_key' AND a.resource_id = k.id AND a.action = 'create'
+  );
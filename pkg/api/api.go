@@ -2,9 +2,13 @@ package api
 
 import (
 	"database/sql"
-	"errors"
+	"log"
+	"math"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"terminal_store/pkg/models"
@@ -12,303 +16,158 @@ import (
 
 type API struct {
 	db *sql.DB
-}
-
-type createProductRequest struct {
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
-	Stock int     `json:"stock"`
-}
-
-type updateStockRequest struct {
-	Stock int `json:"stock"`
-}
-
-type createCustomerRequest struct {
-	Name  string `json:"name"`
-	Phone string `json:"phone"`
-}
-
-type createOrderItem struct {
-	ProductID int64 `json:"product_id"`
-	Qty       int   `json:"qty"`
-}
-
-type createOrderRequest struct {
-	CustomerID int64             `json:"customer_id"`
-	Items      []createOrderItem `json:"items"`
+	// taxRate is applied to the discounted subtotal of new orders, in basis
+	// points (825 = 8.25%).
+	taxRate int64
+	// idempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are kept for replay.
+	idempotencyTTL time.Duration
+	// phoneCountryCode is put in front of customer phone numbers entered
+	// without one, e.g. "1".
+	phoneCountryCode string
 }
 
 func Register(r *gin.Engine, db *sql.DB) {
-	api := &API{db: db}
+	api := &API{db: db, taxRate: taxRateFromEnv(), idempotencyTTL: idempotencyTTLFromEnv(), phoneCountryCode: PhoneCountryCodeFromEnv()}
+	r.Use(requestID)
+	r.NoRoute(func(c *gin.Context) {
+		fail(c, http.StatusNotFound, codeNotFound, "no such endpoint")
+	})
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	})
 
-	r.GET("/products", api.listProducts)
-	r.POST("/products", api.createProduct)
-	r.PATCH("/products/:id/stock", api.updateStock)
-
-	r.GET("/customers", api.listCustomers)
-	r.POST("/customers", api.createCustomer)
-
-	r.GET("/orders", api.listOrders)
-	r.POST("/orders", api.createOrder)
-}
-
-func (a *API) listProducts(c *gin.Context) {
-	rows, err := a.db.Query("SELECT id, name, price, stock, created_at FROM products ORDER BY id")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer rows.Close()
-
-	products := make([]models.Product, 0)
-	for rows.Next() {
-		var p models.Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CreatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		products = append(products, p)
-	}
-	c.JSON(http.StatusOK, products)
-}
-
-func (a *API) createProduct(c *gin.Context) {
-	var req createProductRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-		return
-	}
-	if req.Name == "" || req.Price < 0 || req.Stock < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product fields"})
-		return
-	}
-
-	var p models.Product
-	p.Name = req.Name
-	p.Price = req.Price
-	p.Stock = req.Stock
-	err := a.db.QueryRow(
-		"INSERT INTO products (name, price, stock) VALUES ($1, $2, $3) RETURNING id, created_at",
-		p.Name, p.Price, p.Stock,
-	).Scan(&p.ID, &p.CreatedAt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusCreated, p)
-}
-
-func (a *API) updateStock(c *gin.Context) {
-	idText := c.Param("id")
-	id, err := strconv.ParseInt(idText, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
-		return
-	}
-	var req updateStockRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-		return
-	}
-	if req.Stock < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "stock must be >= 0"})
-		return
-	}
-
-	var p models.Product
-	err = a.db.QueryRow(
-		"UPDATE products SET stock=$1 WHERE id=$2 RETURNING id, name, price, stock, created_at",
-		req.Stock, id,
-	).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, p)
+	r.POST("/auth/login", api.login)
+	r.POST("/auth/refresh", api.refreshSession)
+
+	// Everything else needs a staff login or an API key. Reading is open to every role,
+	// changing data needs clerk and managing keys needs admin.
+	read := r.Group("", api.authenticate, requireRole(models.RoleReadonly))
+	write := r.Group("", api.authenticate, requireRole(models.RoleClerk), api.idempotent)
+	admin := r.Group("/admin", api.authenticate, requireRole(models.RoleAdmin), api.idempotent)
+	// Admin-only routes outside /admin check the role before idempotent, so
+	// a refused request is not stored and replayed.
+	promotionAdmin := r.Group("", api.authenticate, requireRole(models.RoleAdmin), api.idempotent)
+
+	read.GET("/auth/me", api.whoami)
+	read.POST("/auth/logout", api.logout)
+	read.POST("/auth/password", api.changePassword)
+	read.GET("/audit", requireRole(models.RoleAdmin), api.listAudit)
+
+	read.GET("/products", api.listProducts)
+	read.GET("/products/search", api.searchProducts)
+	read.GET("/products/by-barcode/:code", api.getProductByBarcode)
+	write.POST("/products", api.createProduct)
+	read.GET("/products/:id", api.getProduct)
+	write.PATCH("/products/:id", api.updateProduct)
+	write.DELETE("/products/:id", api.deleteProduct)
+	write.PATCH("/products/:id/stock", api.updateStock)
+	write.POST("/products/:id/stock/adjustments", api.adjustStock)
+	read.GET("/products/:id/movements", api.listMovements)
+	write.POST("/products/:id/archive", api.archiveProduct)
+	write.POST("/products/:id/unarchive", api.unarchiveProduct)
+	read.GET("/products/:id/categories", api.listProductCategories)
+	write.PUT("/products/:id/categories", api.setProductCategories)
+	read.GET("/products/:id/prices", api.listPrices)
+	write.POST("/products/:id/prices", api.schedulePrice)
+	read.GET("/products/:id/options", api.listProductOptions)
+	write.POST("/products/:id/options", api.createProductOption)
+	write.POST("/products/:id/options/:option_id/values", api.addOptionValue)
+	read.GET("/products/:id/variants", api.listVariants)
+	write.POST("/products/:id/variants", api.createVariant)
+	write.PATCH("/products/:id/variants/:variant_id", api.updateVariant)
+	write.DELETE("/products/:id/variants/:variant_id", api.deleteVariant)
+
+	read.GET("/categories", api.listCategories)
+	write.POST("/categories", api.createCategory)
+	read.GET("/categories/:id", api.getCategory)
+	write.PATCH("/categories/:id", api.updateCategory)
+	write.DELETE("/categories/:id", api.deleteCategory)
+
+	read.GET("/customers", api.listCustomers)
+	read.GET("/customers/search", api.searchCustomers)
+	read.GET("/customers/phone-conflicts", api.listPhoneConflicts)
+	write.DELETE("/customers/phone-conflicts/:id", api.dismissPhoneConflict)
+	write.POST("/customers", api.createCustomer)
+	read.GET("/customers/:id", api.getCustomer)
+	write.PATCH("/customers/:id", api.updateCustomer)
+	write.DELETE("/customers/:id", api.deleteCustomer)
+	write.POST("/customers/:id/archive", api.archiveCustomer)
+	write.POST("/customers/:id/unarchive", api.unarchiveCustomer)
+	write.POST("/customers/:id/merge", api.mergeCustomers)
+
+	read.GET("/orders", api.listOrders)
+	read.GET("/promotions", api.listPromotions)
+	read.GET("/promotions/by-code/:code", api.getPromotionByCode)
+	promotionAdmin.POST("/promotions", api.createPromotion)
+	read.GET("/promotions/:id", api.getPromotion)
+	promotionAdmin.PATCH("/promotions/:id", api.updatePromotion)
+
+	write.POST("/orders", api.createOrder)
+	read.GET("/orders/:id", api.getOrder)
+	write.PATCH("/orders/:id", api.updateOrder)
+	write.DELETE("/orders/:id", api.deleteOrder)
+	read.GET("/orders/:id/transitions", api.listOrderTransitions)
+	write.POST("/orders/:id/transitions", api.transitionOrder)
+	write.POST("/orders/:id/cancel", api.cancelOrder)
+	read.GET("/orders/:id/returns", api.listReturns)
+	write.POST("/orders/:id/returns", api.createReturn)
+
+	admin.GET("/api-keys", api.listAPIKeys)
+	admin.POST("/api-keys", api.createAPIKey)
+	admin.DELETE("/api-keys/:id", api.revokeAPIKey)
+	admin.GET("/users", api.listUsers)
+	admin.POST("/users", api.createUser)
+	admin.DELETE("/users/:id", api.disableUser)
 }
 
-func (a *API) listCustomers(c *gin.Context) {
-	rows, err := a.db.Query("SELECT id, name, phone, created_at FROM customers ORDER BY id")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// taxRateFromEnv reads TAX_RATE as a fraction (0.0825 for 8.25%). A missing
+// or malformed value disables tax.
+func taxRateFromEnv() int64 {
+	text := os.Getenv("TAX_RATE")
+	if text == "" {
+		return 0
 	}
-	defer rows.Close()
-
-	customers := make([]models.Customer, 0)
-	for rows.Next() {
-		var cu models.Customer
-		if err := rows.Scan(&cu.ID, &cu.Name, &cu.Phone, &cu.CreatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		customers = append(customers, cu)
+	rate, err := strconv.ParseFloat(text, 64)
+	if err != nil || rate < 0 {
+		log.Printf("ignoring invalid TAX_RATE %q", text)
+		return 0
 	}
-	c.JSON(http.StatusOK, customers)
+	return int64(math.Round(rate * 10000))
 }
 
-func (a *API) createCustomer(c *gin.Context) {
-	var req createCustomerRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-		return
-	}
-	if req.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
-		return
+// PhoneCountryCodeFromEnv reads PHONE_COUNTRY_CODE, the calling code for
+// local phone numbers. It defaults to 1 (North America). The server also
+// hands it to the migrations that normalize stored phones.
+func PhoneCountryCodeFromEnv() string {
+	text := strings.TrimPrefix(os.Getenv("PHONE_COUNTRY_CODE"), "+")
+	if text == "" {
+		return "1"
 	}
-
-	var cu models.Customer
-	cu.Name = req.Name
-	cu.Phone = req.Phone
-	err := a.db.QueryRow(
-		"INSERT INTO customers (name, phone) VALUES ($1, $2) RETURNING id, created_at",
-		cu.Name, cu.Phone,
-	).Scan(&cu.ID, &cu.CreatedAt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	if n, err := strconv.Atoi(text); err != nil || n <= 0 || len(text) > 3 {
+		log.Printf("ignoring invalid PHONE_COUNTRY_CODE %q", text)
+		return "1"
 	}
-
-	c.JSON(http.StatusCreated, cu)
+	return text
 }
 
-func (a *API) listOrders(c *gin.Context) {
-	rows, err := a.db.Query("SELECT id, customer_id, created_at FROM orders ORDER BY id")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer rows.Close()
-
-	orders := make([]models.Order, 0)
-	for rows.Next() {
-		var o models.Order
-		if err := rows.Scan(&o.ID, &o.CustomerID, &o.CreatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		items, err := a.orderItems(o.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		o.Items = items
-		orders = append(orders, o)
-	}
-	c.JSON(http.StatusOK, orders)
+// rowQueryer is satisfied by both *sql.DB and *sql.Tx.
+type rowQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
 }
 
-func (a *API) orderItems(orderID int64) ([]models.OrderItem, error) {
-	rows, err := a.db.Query("SELECT id, order_id, product_id, qty, price_each FROM order_items WHERE order_id=$1 ORDER BY id", orderID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	items := make([]models.OrderItem, 0)
-	for rows.Next() {
-		var it models.OrderItem
-		if err := rows.Scan(&it.ID, &it.OrderID, &it.ProductID, &it.Qty, &it.PriceEach); err != nil {
-			return nil, err
-		}
-		items = append(items, it)
-	}
-	return items, nil
+func parseID(c *gin.Context, what string) (int64, bool) {
+	return parseIDParam(c, "id", what)
 }
 
-func (a *API) createOrder(c *gin.Context) {
-	var req createOrderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-		return
-	}
-	if req.CustomerID <= 0 || len(req.Items) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "customer_id and items required"})
-		return
-	}
-	for _, it := range req.Items {
-		if it.ProductID <= 0 || it.Qty <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item in order"})
-			return
-		}
-	}
-
-	tx, err := a.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer tx.Rollback()
-
-	var exists bool
-	if err := tx.QueryRow("SELECT true FROM customers WHERE id=$1", req.CustomerID).Scan(&exists); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// parseIDParam reads the id in the path parameter param, for routes that
+// carry more than one id such as /products/:id/variants/:variant_id.
+func parseIDParam(c *gin.Context, param, what string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(param), 10, 64)
+	if err != nil || id <= 0 {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "invalid "+what+" id")
+		return 0, false
 	}
-
-	var order models.Order
-	order.CustomerID = req.CustomerID
-	if err := tx.QueryRow("INSERT INTO orders (customer_id) VALUES ($1) RETURNING id, created_at", req.CustomerID).Scan(&order.ID, &order.CreatedAt); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	order.Items = make([]models.OrderItem, 0, len(req.Items))
-	for _, it := range req.Items {
-		var price float64
-		var stock int
-		err := tx.QueryRow("SELECT price, stock FROM products WHERE id=$1 FOR UPDATE", it.ProductID).Scan(&price, &stock)
-		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		if stock < it.Qty {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock"})
-			return
-		}
-		if _, err := tx.Exec("UPDATE products SET stock=stock-$1 WHERE id=$2", it.Qty, it.ProductID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		var item models.OrderItem
-		item.OrderID = order.ID
-		item.ProductID = it.ProductID
-		item.Qty = it.Qty
-		item.PriceEach = price
-		if err := tx.QueryRow(
-			"INSERT INTO order_items (order_id, product_id, qty, price_each) VALUES ($1, $2, $3, $4) RETURNING id",
-			order.ID, it.ProductID, it.Qty, price,
-		).Scan(&item.ID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		order.Items = append(order.Items, item)
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusCreated, order)
+	return id, true
 }
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRegister catches routes that gin cannot tell apart, which it only
+// reports by panicking at startup.
+func TestRegister(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Register(gin.New(), nil)
+}
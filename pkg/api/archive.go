@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+func (a *API) archiveProduct(c *gin.Context) {
+	setArchived(a, c, "products", "product", true, loadProduct, productVersion)
+}
+
+func (a *API) unarchiveProduct(c *gin.Context) {
+	setArchived(a, c, "products", "product", false, loadProduct, productVersion)
+}
+
+func (a *API) archiveCustomer(c *gin.Context) {
+	setArchived(a, c, "customers", "customer", true, loadCustomer, customerVersion)
+}
+
+func (a *API) unarchiveCustomer(c *gin.Context) {
+	setArchived(a, c, "customers", "customer", false, loadCustomer, customerVersion)
+}
+
+func productVersion(p models.Product) int   { return p.Version }
+func customerVersion(c models.Customer) int { return c.Version }
+
+// setArchived sets or clears archived_at on one row of table and responds
+// with the reloaded resource. Archiving an already archived row keeps its
+// original timestamp. Like any other change it needs the version the
+// client last saw, in If-Match or a version field.
+func setArchived[T any](a *API, c *gin.Context, table, what string, archived bool, load func(rowQueryer, int64, bool) (T, error), versionOf func(T) int) {
+	id, ok := parseID(c, what)
+	if !ok {
+		return
+	}
+	version, ok := expectedDeleteVersion(c)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := load(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, what+" not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, versionOf(before), what) {
+		return
+	}
+	query, action := "UPDATE "+table+" SET archived_at = NULL WHERE id=$1", auditUnarchive
+	if archived {
+		query, action = "UPDATE "+table+" SET archived_at = COALESCE(archived_at, NOW()) WHERE id=$1", auditArchive
+	}
+	if _, err := tx.Exec(query, id); err != nil {
+		failErr(c, err)
+		return
+	}
+	after, err := load(tx, id, false)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, action, what, id, before, after); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, versionOf(after))
+	c.JSON(http.StatusOK, after)
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+const ctxRequestID = "request_id"
+
+// Audit actions beyond plain create, update and delete.
+const (
+	auditCreate     = "create"
+	auditUpdate     = "update"
+	auditDelete     = "delete"
+	auditArchive    = "archive"
+	auditUnarchive  = "unarchive"
+	auditTransition = "transition"
+	auditAdjust     = "adjust_stock"
+	auditRevoke     = "revoke"
+	auditDisable    = "disable"
+	auditPassword   = "change_password"
+	auditMerge      = "merge"
+)
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID tags every request with an id, taken from X-Request-ID when the
+// client sent a sensible one, and echoes it in the response so a client's
+// report can be matched to the audit log.
+func requestID(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if !validRequestID.MatchString(id) {
+		b := make([]byte, 12)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	c.Set(ctxRequestID, id)
+	c.Header("X-Request-ID", id)
+	c.Next()
+}
+
+// recordAudit appends an entry for a change to the audit log. It must be
+// called with the transaction that makes the change, so the entry exists
+// exactly when the change does. before or after may be nil.
+func recordAudit(tx *sql.Tx, c *gin.Context, action, resourceType string, resourceID int64, before, after any) error {
+	beforeJSON, err := auditSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditSnapshot(after)
+	if err != nil {
+		return err
+	}
+	actorType, actorID := requestActor(c)
+	_, err = tx.Exec(
+		`INSERT INTO audit_log (request_id, actor_type, actor_id, actor_name, method, route, resource_type, resource_id, action, before, after)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		c.GetString(ctxRequestID), actorType, actorID, c.GetString(ctxActorName), c.Request.Method, c.FullPath(),
+		resourceType, resourceID, action, beforeJSON, afterJSON,
+	)
+	return err
+}
+
+// requestActor names who made an authenticated request: a staff user or an
+// API key.
+func requestActor(c *gin.Context) (string, int64) {
+	if userID := c.GetInt64(ctxUserID); userID != 0 {
+		return "user", userID
+	}
+	return "api_key", c.GetInt64(ctxAPIKeyID)
+}
+
+// auditSnapshot encodes v for a JSONB column, mapping nil to NULL.
+func auditSnapshot(v any) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := string(b)
+	return &s, nil
+}
+
+var auditSorts = map[string]sortField{
+	"id": {"id", "int"},
+}
+
+func (a *API) listAudit(c *gin.Context) {
+	pg, ok := parsePage(c, auditSorts, "-id")
+	if !ok {
+		return
+	}
+	var q listQuery
+	for _, f := range []string{"resource_type", "action", "actor_type", "actor_name", "request_id"} {
+		if v := c.Query(f); v != "" {
+			q.filter(f + " = " + q.arg(v))
+		}
+	}
+	for _, f := range []string{"resource_id", "actor_id"} {
+		v, ok := queryInt(c, f)
+		if !ok {
+			return
+		}
+		if v != nil {
+			q.filter(f + " = " + q.arg(*v))
+		}
+	}
+	from, ok := queryTime(c, "created_from")
+	if !ok {
+		return
+	}
+	if from != nil {
+		q.filter("created_at >= " + q.arg(*from) + "::timestamptz::timestamp")
+	}
+	to, ok := queryTime(c, "created_to")
+	if !ok {
+		return
+	}
+	if to != nil {
+		q.filter("created_at < " + q.arg(*to) + "::timestamptz::timestamp")
+	}
+
+	query := `SELECT id, request_id, actor_type, actor_id, actor_name, method, route, resource_type, resource_id, action,
+	 before, after, created_at, ` + pg.sort.column + "::text FROM audit_log" + q.build(pg, "id")
+	rows, err := a.db.Query(query, q.args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+	keys := make([]pageCursor, 0)
+	for rows.Next() {
+		var e models.AuditEntry
+		var key pageCursor
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.RequestID, &e.ActorType, &e.ActorID, &e.ActorName, &e.Method, &e.Route,
+			&e.ResourceType, &e.ResourceID, &e.Action, &before, &after, &e.CreatedAt, &key.Value); err != nil {
+			failErr(c, err)
+			return
+		}
+		e.Before, e.After = before, after
+		key.ID = e.ID
+		entries = append(entries, e)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, finishPage(pg, entries, keys))
+}
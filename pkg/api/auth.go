@@ -0,0 +1,321 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+const (
+	apiKeyPrefixLen = 11
+	ctxAPIKeyID     = "api_key_id"
+	ctxUserID       = "user_id"
+	ctxSessionID    = "session_id"
+	ctxRole         = "role"
+	ctxActorName    = "actor_name"
+)
+
+// createdAPIKey is the only response that ever contains the key itself.
+type createdAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+var apiKeySorts = map[string]sortField{
+	"id": {"id", "int"},
+}
+
+func hashToken(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken returns a random secret. The prefix tells API keys ("tsk_"),
+// access tokens ("tsa_") and refresh tokens ("tsr_") apart.
+func newToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// minBootstrapKeyLen is the shortest ADMIN_API_KEY BootstrapAdminKey
+// accepts; a key from newToken is far longer.
+const minBootstrapKeyLen = 32
+
+// weakBootstrapKeys are placeholder values that show up in example
+// configurations and must never become a working admin key.
+var weakBootstrapKeys = map[string]bool{
+	"change-me": true, "changeme": true, "admin": true, "password": true, "secret": true,
+}
+
+// BootstrapAdminKey stores key as an admin key unless it is already known,
+// so a fresh installation has a way to create the other keys. The
+// bootstrap key follows the setting: any earlier one is revoked when key
+// changes or is cleared. A placeholder or short key is refused with a
+// warning in the log rather than stored.
+func BootstrapAdminKey(db *sql.DB, key string) error {
+	key = strings.TrimSpace(key)
+	if key != "" && !bootstrapKeyUsable(key) {
+		log.Printf("WARNING: refusing ADMIN_API_KEY: it must be a random value of at least %d characters, not a placeholder; no bootstrap admin key is active", minBootstrapKeyLen)
+		key = ""
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"UPDATE api_keys SET revoked_at = NOW() WHERE bootstrap AND revoked_at IS NULL AND key_hash <> $1",
+		hashToken(key),
+	); err != nil {
+		return err
+	}
+	if key != "" {
+		if _, err := tx.Exec(
+			"INSERT INTO api_keys (name, prefix, key_hash, role, bootstrap) VALUES ('bootstrap', $1, $2, 'admin', true) ON CONFLICT (key_hash) DO NOTHING",
+			keyPrefix(key), hashToken(key),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// bootstrapKeyUsable reports whether key is long enough and not a known
+// placeholder to serve as the bootstrap admin key.
+func bootstrapKeyUsable(key string) bool {
+	return len(key) >= minBootstrapKeyLen && !weakBootstrapKeys[strings.ToLower(key)]
+}
+
+func keyPrefix(key string) string {
+	if len(key) > apiKeyPrefixLen {
+		return key[:apiKeyPrefixLen]
+	}
+	return key
+}
+
+// authenticate resolves the bearer token to a staff session or an API key
+// and stores who made the request and their role on the context. Missing,
+// unknown, expired and revoked tokens get a 401.
+func (a *API) authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		c.Header("WWW-Authenticate", "Bearer")
+		fail(c, http.StatusUnauthorized, codeUnauthorized, "missing credentials")
+		return
+	}
+
+	var role models.Role
+	var name string
+	var err error
+	if strings.HasPrefix(token, "tsa_") {
+		var sessionID, userID int64
+		err = a.db.QueryRow(
+			`SELECT s.id, u.id, u.username, u.role FROM sessions s JOIN users u ON u.id = s.user_id
+			 WHERE s.access_hash=$1 AND s.revoked_at IS NULL AND s.access_expires_at > NOW() AND u.disabled_at IS NULL`,
+			hashToken(token),
+		).Scan(&sessionID, &userID, &name, &role)
+		c.Set(ctxSessionID, sessionID)
+		c.Set(ctxUserID, userID)
+	} else {
+		var keyID int64
+		err = a.db.QueryRow(
+			"SELECT id, name, role FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL",
+			hashToken(token),
+		).Scan(&keyID, &name, &role)
+		c.Set(ctxAPIKeyID, keyID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		fail(c, http.StatusUnauthorized, codeUnauthorized, "invalid or expired credentials")
+		return
+	}
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	c.Set(ctxRole, role)
+	c.Set(ctxActorName, name)
+	c.Next()
+}
+
+// requireRole rejects authenticated callers whose role is below required.
+func requireRole(required models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, _ := c.Get(ctxRole)
+		role, _ := v.(models.Role)
+		if !role.Allows(required) {
+			fail(c, http.StatusForbidden, codeForbidden, "requires "+string(required)+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// whoami describes the user or API key the request was made with.
+func (a *API) whoami(c *gin.Context) {
+	if userID := c.GetInt64(ctxUserID); userID != 0 {
+		u, err := loadUser(a.db, userID)
+		if err != nil {
+			failErr(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"type": "user", "id": u.ID, "name": u.Username, "role": u.Role})
+		return
+	}
+	k, err := loadAPIKey(a.db, c.GetInt64(ctxAPIKeyID))
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"type": "api_key", "id": k.ID, "name": k.Name, "role": k.Role})
+}
+
+func (a *API) listAPIKeys(c *gin.Context) {
+	pg, ok := parsePage(c, apiKeySorts, "id")
+	if !ok {
+		return
+	}
+	var q listQuery
+	if c.Query("include_revoked") != "true" {
+		q.filter("revoked_at IS NULL")
+	}
+
+	query := "SELECT id, name, prefix, role, created_at, revoked_at, " + pg.sort.column + "::text FROM api_keys" + q.build(pg, "id")
+	rows, err := a.db.Query(query, q.args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	cursors := make([]pageCursor, 0)
+	for rows.Next() {
+		var k models.APIKey
+		var cur pageCursor
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Role, &k.CreatedAt, &k.RevokedAt, &cur.Value); err != nil {
+			failErr(c, err)
+			return
+		}
+		cur.ID = k.ID
+		keys = append(keys, k)
+		cursors = append(cursors, cur)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, finishPage(pg, keys, cursors))
+}
+
+func (a *API) createAPIKey(c *gin.Context) {
+	var req models.NewAPIKey
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	key, err := newToken("tsk_")
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	out := createdAPIKey{Key: key}
+	out.Name = req.Name
+	out.Role = req.Role
+	out.Prefix = keyPrefix(key)
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"INSERT INTO api_keys (name, prefix, key_hash, role) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		out.Name, out.Prefix, hashToken(key), out.Role,
+	).Scan(&out.ID, &out.CreatedAt)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "api_key", out.ID, nil, out.APIKey); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, out)
+}
+
+// revokeAPIKey disables a key for good. The row is kept so listings still
+// show who had access.
+func (a *API) revokeAPIKey(c *gin.Context) {
+	id, ok := parseID(c, "API key")
+	if !ok {
+		return
+	}
+	if id == c.GetInt64(ctxAPIKeyID) {
+		fail(c, http.StatusConflict, codeConflict, "cannot revoke the key used for this request")
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadAPIKey(tx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "API key not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	after, err := loadAPIKey(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditRevoke, "api_key", id, before, after); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func loadAPIKey(q rowQueryer, id int64) (models.APIKey, error) {
+	var k models.APIKey
+	err := q.QueryRow("SELECT id, name, prefix, role, created_at, revoked_at FROM api_keys WHERE id=$1", id).
+		Scan(&k.ID, &k.Name, &k.Prefix, &k.Role, &k.CreatedAt, &k.RevokedAt)
+	return k, err
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+// TestRequireRole checks each role against the role required by the
+// route groups of Register: reading needs readonly, changing data needs
+// clerk and managing keys and users needs admin.
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	groups := []struct {
+		name     string
+		required models.Role
+	}{
+		{"read", models.RoleReadonly},
+		{"write", models.RoleClerk},
+		{"admin", models.RoleAdmin},
+	}
+	tests := []struct {
+		role  models.Role
+		allow map[string]bool
+	}{
+		{"", map[string]bool{}},
+		{"owner", map[string]bool{}},
+		{models.RoleReadonly, map[string]bool{"read": true}},
+		{models.RoleClerk, map[string]bool{"read": true, "write": true}},
+		{models.RoleAdmin, map[string]bool{"read": true, "write": true, "admin": true}},
+	}
+	for _, tt := range tests {
+		for _, g := range groups {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				c.Set(ctxRole, tt.role)
+			}, requireRole(g.required), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			want := http.StatusForbidden
+			if tt.allow[g.name] {
+				want = http.StatusOK
+			}
+			if w.Code != want {
+				t.Errorf("role %q on the %s group: status %d, want %d", tt.role, g.name, w.Code, want)
+			}
+		}
+	}
+}
+
+func TestBootstrapKeyUsable(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"change-me", false},
+		{"CHANGEME", false},
+		{"admin", false},
+		{"password", false},
+		{"tsk_0123456789abcdef", false},
+		{strings.Repeat("a", minBootstrapKeyLen-1), false},
+		{strings.Repeat("a", minBootstrapKeyLen), true},
+		{"tsk_3f9a1c0e7b2d4a6f8e1c3b5d7f9a0c2e4b6d8f0a", true},
+	}
+	for _, tt := range tests {
+		if got := bootstrapKeyUsable(tt.key); got != tt.want {
+			t.Errorf("bootstrapKeyUsable(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
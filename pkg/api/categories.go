@@ -0,0 +1,399 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+type createCategoryRequest struct {
+	Name     string `json:"name" validate:"notblank,max=100"`
+	ParentID *int64 `json:"parent_id" validate:"omitnil,gt=0"`
+}
+
+// updateCategoryRequest moves a category to the top level when ParentID
+// is 0.
+type updateCategoryRequest struct {
+	Name     *string `json:"name" validate:"omitnil,notblank,max=100"`
+	ParentID *int64  `json:"parent_id" validate:"omitnil,min=0"`
+}
+
+type setProductCategoriesRequest struct {
+	CategoryIDs []int64 `json:"category_ids" validate:"max=50,dive,gt=0"`
+}
+
+// categorySubtree returns a query selecting the id of the category given by
+// the placeholder arg and the ids of every category below it.
+func categorySubtree(arg string) string {
+	return "WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=" + arg +
+		" UNION SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id) SELECT id FROM tree"
+}
+
+// listCategories lists every category, or with parent_id only the children
+// of one category (0 for the top level), sorted by name.
+func (a *API) listCategories(c *gin.Context) {
+	query := "SELECT id, parent_id, name, created_at FROM categories"
+	var args []any
+	if text := c.Query("parent_id"); text != "" {
+		parentID, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || parentID < 0 {
+			invalidField(c, "parent_id", "must be a category id, or 0 for the top level")
+			return
+		}
+		if parentID == 0 {
+			query += " WHERE parent_id IS NULL"
+		} else {
+			query += " WHERE parent_id=$1"
+			args = append(args, parentID)
+		}
+	}
+	rows, err := a.db.Query(query+" ORDER BY lower(name), id", args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	categories := make([]models.Category, 0)
+	for rows.Next() {
+		var cat models.Category
+		if err := rows.Scan(&cat.ID, &cat.ParentID, &cat.Name, &cat.CreatedAt); err != nil {
+			failErr(c, err)
+			return
+		}
+		categories = append(categories, cat)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+func (a *API) createCategory(c *gin.Context) {
+	var req createCategoryRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.ParentID != nil {
+		if _, err := loadCategory(tx, *req.ParentID, false); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				invalidField(c, "parent_id", "no such category")
+				return
+			}
+			failErr(c, err)
+			return
+		}
+	}
+	cat := models.Category{ParentID: req.ParentID, Name: req.Name}
+	err = tx.QueryRow(
+		"INSERT INTO categories (parent_id, name) VALUES ($1, $2) RETURNING id, created_at",
+		cat.ParentID, cat.Name,
+	).Scan(&cat.ID, &cat.CreatedAt)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "category", cat.ID, nil, cat); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, cat)
+}
+
+func (a *API) getCategory(c *gin.Context) {
+	id, ok := parseID(c, "category")
+	if !ok {
+		return
+	}
+	cat, err := loadCategory(a.db, id, false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "category not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cat)
+}
+
+// updateCategory renames a category or moves it, with everything below it,
+// under another parent. A category cannot be moved below itself.
+func (a *API) updateCategory(c *gin.Context) {
+	id, ok := parseID(c, "category")
+	if !ok {
+		return
+	}
+	var req updateCategoryRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.Name == nil && req.ParentID == nil {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "nothing to update")
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.ParentID != nil {
+		// Two moves checked at the same time could together form a loop,
+		// so moves take turns.
+		if _, err := tx.Exec("LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	cat, err := loadCategory(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "category not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	before := cat
+	if req.Name != nil {
+		cat.Name = *req.Name
+	}
+	if req.ParentID != nil {
+		cat.ParentID = nil
+		if *req.ParentID != 0 {
+			var exists, inside bool
+			err := tx.QueryRow(
+				"SELECT EXISTS (SELECT 1 FROM categories WHERE id=$2), $2 IN ("+categorySubtree("$1")+")",
+				id, *req.ParentID,
+			).Scan(&exists, &inside)
+			if err != nil {
+				failErr(c, err)
+				return
+			}
+			if !exists {
+				invalidField(c, "parent_id", "no such category")
+				return
+			}
+			if inside {
+				invalidField(c, "parent_id", "must not be the category itself or one below it")
+				return
+			}
+			cat.ParentID = req.ParentID
+		}
+	}
+	if _, err := tx.Exec("UPDATE categories SET name=$1, parent_id=$2 WHERE id=$3", cat.Name, cat.ParentID, id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "category", id, before, cat); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cat)
+}
+
+// deleteCategory removes an empty branch of the tree. Products in the
+// category stay, they just lose that assignment.
+func (a *API) deleteCategory(c *gin.Context) {
+	id, ok := parseID(c, "category")
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	cat, err := loadCategory(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "category not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	var hasChildren bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id=$1)", id).Scan(&hasChildren); err != nil {
+		failErr(c, err)
+		return
+	}
+	if hasChildren {
+		fail(c, http.StatusConflict, codeConflict, "category has subcategories; move or delete them first")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM categories WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditDelete, "category", id, cat, nil); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (a *API) listProductCategories(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	if _, err := loadProduct(a.db, id, false); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	categories, err := productCategories(a.db, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+// setProductCategories replaces the categories a product is assigned to.
+func (a *API) setProductCategories(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	var req setProductCategoriesRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := loadProduct(tx, id, true); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	before, err := productCategories(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	var found int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM categories WHERE id = ANY($1)", req.CategoryIDs).Scan(&found); err != nil {
+		failErr(c, err)
+		return
+	}
+	if found != len(uniqueIDs(req.CategoryIDs)) {
+		invalidField(c, "category_ids", "contains an unknown category")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM product_categories WHERE product_id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO product_categories (product_id, category_id) SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING",
+		id, req.CategoryIDs,
+	); err != nil {
+		failErr(c, err)
+		return
+	}
+	after, err := productCategories(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "product", id, gin.H{"categories": before}, gin.H{"categories": after}); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
+
+// productCategories lists the categories a product is assigned to.
+func productCategories(q queryer, productID int64) ([]models.Category, error) {
+	rows, err := q.Query(
+		`SELECT c.id, c.parent_id, c.name, c.created_at FROM categories c
+		 JOIN product_categories pc ON pc.category_id = c.id
+		 WHERE pc.product_id=$1 ORDER BY lower(c.name), c.id`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := make([]models.Category, 0)
+	for rows.Next() {
+		var cat models.Category
+		if err := rows.Scan(&cat.ID, &cat.ParentID, &cat.Name, &cat.CreatedAt); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+func uniqueIDs(ids []int64) map[int64]bool {
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// loadCategory fetches one category, locking its row when forUpdate is set.
+func loadCategory(q rowQueryer, id int64, forUpdate bool) (models.Category, error) {
+	query := "SELECT id, parent_id, name, created_at FROM categories WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var cat models.Category
+	err := q.QueryRow(query, id).Scan(&cat.ID, &cat.ParentID, &cat.Name, &cat.CreatedAt)
+	return cat, err
+}
@@ -0,0 +1,617 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+	"terminal_store/pkg/validate"
+)
+
+type updateCustomerRequest struct {
+	Name    *string `json:"name" validate:"omitnil,notblank,max=100"`
+	Phone   *string `json:"phone" validate:"omitnil,phone"`
+	Version *int    `json:"version"`
+}
+
+// customerMatch is one result of a customer search. Rank runs from 0 to 1,
+// higher for better matches.
+type customerMatch struct {
+	models.Customer
+	Rank float64 `json:"rank"`
+}
+
+const (
+	customerSearchLimit    = 10
+	customerSearchMaxLimit = 50
+)
+
+// mergeCustomersRequest names the duplicate and the version of it the
+// client looked at; the survivor's version comes from If-Match or Version.
+type mergeCustomersRequest struct {
+	DuplicateID      int64 `json:"duplicate_id" validate:"required,gt=0"`
+	DuplicateVersion *int  `json:"duplicate_version" validate:"required"`
+	Version          *int  `json:"version"`
+}
+
+// mergedCustomer is the audit snapshot of a survivor after a merge: the
+// customer together with where its new orders came from.
+type mergedCustomer struct {
+	models.Customer
+	MergedFrom    int64   `json:"merged_from"`
+	MovedOrderIDs []int64 `json:"moved_order_ids"`
+}
+
+var customerSorts = map[string]sortField{
+	"id":         {"id", "int"},
+	"name":       {"name", "text"},
+	"created_at": {"created_at", "timestamp"},
+}
+
+func (a *API) listCustomers(c *gin.Context) {
+	pg, ok := parsePage(c, customerSorts, "id")
+	if !ok {
+		return
+	}
+	var q listQuery
+	if c.Query("include_archived") != "true" {
+		q.filter("archived_at IS NULL")
+	}
+	if prefix := c.Query("name_prefix"); prefix != "" {
+		q.filter("name ILIKE " + q.arg(prefixPattern(prefix)))
+	}
+
+	query := "SELECT id, name, COALESCE(phone, ''), version, created_at, archived_at, " + pg.sort.column + "::text FROM customers" + q.build(pg, "id")
+	rows, err := a.db.Query(query, q.args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	customers := make([]models.Customer, 0)
+	keys := make([]pageCursor, 0)
+	for rows.Next() {
+		var cu models.Customer
+		var key pageCursor
+		if err := rows.Scan(&cu.ID, &cu.Name, &cu.Phone, &cu.Version, &cu.CreatedAt, &cu.ArchivedAt, &key.Value); err != nil {
+			failErr(c, err)
+			return
+		}
+		key.ID = cu.ID
+		customers = append(customers, cu)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, finishPage(pg, customers, keys))
+}
+
+// searchCustomers finds customers whose name or phone partly matches q,
+// best matches first. Names also match when spelled slightly differently;
+// q is compared with phones by its digits alone, so "555 0101" finds
+// "+15550101".
+func (a *API) searchCustomers(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		invalidField(c, "q", "is required")
+		return
+	}
+	limit, ok := queryInt(c, "limit")
+	if !ok {
+		return
+	}
+	n := int64(customerSearchLimit)
+	if limit != nil {
+		if *limit < 1 || *limit > customerSearchMaxLimit {
+			invalidField(c, "limit", fmt.Sprintf("must be between 1 and %d", customerSearchMaxLimit))
+			return
+		}
+		n = *limit
+	}
+	// Fewer than three digits would match most phone numbers.
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, q)
+	if len(digits) < 3 {
+		digits = ""
+	}
+	archived := " AND archived_at IS NULL"
+	if c.Query("include_archived") == "true" {
+		archived = ""
+	}
+
+	rows, err := a.db.Query(`
+		SELECT id, name, COALESCE(phone, ''), version, created_at, archived_at,
+		       GREATEST(
+		         similarity(name, $1),
+		         CASE WHEN name ILIKE $2 THEN 0.9 WHEN name ILIKE $3 THEN 0.6 ELSE 0 END,
+		         CASE WHEN $4 <> '' AND phone LIKE $5 THEN 1 ELSE 0 END
+		       )::float8 AS rank
+		FROM customers
+		WHERE (name ILIKE $3 OR name % $1 OR ($4 <> '' AND phone LIKE $5))`+archived+`
+		ORDER BY rank DESC, name, id
+		LIMIT $6`,
+		q, prefixPattern(q), containsPattern(q), digits, containsPattern(digits), n,
+	)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	matches := make([]customerMatch, 0)
+	for rows.Next() {
+		var m customerMatch
+		if err := rows.Scan(&m.ID, &m.Name, &m.Phone, &m.Version, &m.CreatedAt, &m.ArchivedAt, &m.Rank); err != nil {
+			failErr(c, err)
+			return
+		}
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
+func (a *API) createCustomer(c *gin.Context) {
+	var req models.NewCustomer
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	phone, ok := a.normalizePhone(c, req.Phone)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if phoneTaken(c, tx, phone, 0) {
+		return
+	}
+	var cu models.Customer
+	cu.Name = req.Name
+	cu.Phone = phone
+	err = tx.QueryRow(
+		"INSERT INTO customers (name, phone) VALUES ($1, NULLIF($2, '')) RETURNING id, version, created_at",
+		cu.Name, cu.Phone,
+	).Scan(&cu.ID, &cu.Version, &cu.CreatedAt)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "customer", cu.ID, nil, cu); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, cu.Version)
+	c.JSON(http.StatusCreated, cu)
+}
+
+func (a *API) getCustomer(c *gin.Context) {
+	id, ok := parseID(c, "customer")
+	if !ok {
+		return
+	}
+	cu, err := loadCustomer(a.db, id, false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "customer not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	setETag(c, cu.Version)
+	c.JSON(http.StatusOK, cu)
+}
+
+func (a *API) updateCustomer(c *gin.Context) {
+	id, ok := parseID(c, "customer")
+	if !ok {
+		return
+	}
+	var req updateCustomerRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.Name == nil && req.Phone == nil {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "nothing to update")
+		return
+	}
+	if req.Phone != nil {
+		phone, ok := a.normalizePhone(c, *req.Phone)
+		if !ok {
+			return
+		}
+		req.Phone = &phone
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	cu, err := loadCustomer(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "customer not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, cu.Version, "customer") {
+		return
+	}
+	before := cu
+	if req.Name != nil {
+		cu.Name = *req.Name
+	}
+	if req.Phone != nil {
+		if phoneTaken(c, tx, *req.Phone, id) {
+			return
+		}
+		cu.Phone = *req.Phone
+	}
+	if err := tx.QueryRow("UPDATE customers SET name=$1, phone=NULLIF($2, '') WHERE id=$3 RETURNING version", cu.Name, cu.Phone, id).Scan(&cu.Version); err != nil {
+		failErr(c, err)
+		return
+	}
+	if req.Phone != nil {
+		// The customer's phone has been settled by hand.
+		if _, err := tx.Exec("DELETE FROM customer_phone_conflicts WHERE customer_id=$1", id); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	if err := recordAudit(tx, c, auditUpdate, "customer", id, before, cu); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, cu.Version)
+	c.JSON(http.StatusOK, cu)
+}
+
+func (a *API) deleteCustomer(c *gin.Context) {
+	id, ok := parseID(c, "customer")
+	if !ok {
+		return
+	}
+	version, ok := expectedDeleteVersion(c)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	cu, err := loadCustomer(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "customer not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, cu.Version, "customer") {
+		return
+	}
+	var ordered bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM orders WHERE customer_id=$1)", id).Scan(&ordered); err != nil {
+		failErr(c, err)
+		return
+	}
+	if ordered {
+		fail(c, http.StatusConflict, codeConflict, "customer has orders; archive it instead")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM customers WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditDelete, "customer", id, cu, nil); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// mergeCustomers folds the customer named by duplicate_id into the one in
+// the path: its orders move over, the survivor takes its phone if it has
+// none, and the duplicate is deleted. Both customers must still be at the
+// versions the client saw, and an archived survivor is refused.
+func (a *API) mergeCustomers(c *gin.Context) {
+	id, ok := parseID(c, "customer")
+	if !ok {
+		return
+	}
+	var req mergeCustomersRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.DuplicateID == id {
+		invalidField(c, "duplicate_id", "must differ from the surviving customer")
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock both rows in id order so two merges of the same pair cannot
+	// deadlock.
+	locked := make(map[int64]models.Customer, 2)
+	for _, cid := range []int64{min(id, req.DuplicateID), max(id, req.DuplicateID)} {
+		cu, err := loadCustomer(tx, cid, true)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				fail(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("customer %d not found", cid))
+				return
+			}
+			failErr(c, err)
+			return
+		}
+		locked[cid] = cu
+	}
+	survivor, dup := locked[id], locked[req.DuplicateID]
+	if !versionMatches(c, version, survivor.Version, "customer") ||
+		!versionMatches(c, req.DuplicateVersion, dup.Version, "duplicate customer") {
+		return
+	}
+	if survivor.ArchivedAt != nil {
+		fail(c, http.StatusConflict, codeConflict, "cannot merge into an archived customer; unarchive it first")
+		return
+	}
+
+	// Every order that moves is audited on its own, so it can be traced
+	// back to the customer it was placed under.
+	orderIDs, err := lockCustomerOrders(tx, dup.ID)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	movedFrom := make([]models.Order, len(orderIDs))
+	for i, oid := range orderIDs {
+		if movedFrom[i], err = loadOrder(tx, oid); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	if _, err := tx.Exec("UPDATE orders SET customer_id=$1 WHERE customer_id=$2", id, dup.ID); err != nil {
+		failErr(c, err)
+		return
+	}
+	for i, oid := range orderIDs {
+		moved, err := loadOrder(tx, oid)
+		if err != nil {
+			failErr(c, err)
+			return
+		}
+		if err := recordAudit(tx, c, auditMerge, "order", oid, movedFrom[i], moved); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM customers WHERE id=$1", dup.ID); err != nil {
+		failErr(c, err)
+		return
+	}
+	if survivor.Phone == "" && dup.Phone != "" {
+		if _, err := tx.Exec("UPDATE customers SET phone=$1 WHERE id=$2", dup.Phone, id); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	after, err := loadCustomer(tx, id, false)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditMerge, "customer", dup.ID, dup, after); err != nil {
+		failErr(c, err)
+		return
+	}
+	merged := mergedCustomer{Customer: after, MergedFrom: dup.ID, MovedOrderIDs: orderIDs}
+	if err := recordAudit(tx, c, auditMerge, "customer", id, survivor, merged); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, after.Version)
+	c.JSON(http.StatusOK, after)
+}
+
+// listPhoneConflicts reports the phone numbers set aside when phones moved
+// to E.164 form: numbers that could not be read, and customers sharing a
+// number with an older customer, who are candidates for a merge.
+func (a *API) listPhoneConflicts(c *gin.Context) {
+	rows, err := a.db.Query(
+		`SELECT pc.id, pc.customer_id, cu.name, pc.raw_phone, pc.duplicate_of, pc.created_at
+		 FROM customer_phone_conflicts pc JOIN customers cu ON cu.id = pc.customer_id
+		 ORDER BY pc.id`,
+	)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	conflicts := make([]models.PhoneConflict, 0)
+	for rows.Next() {
+		var pc models.PhoneConflict
+		if err := rows.Scan(&pc.ID, &pc.CustomerID, &pc.CustomerName, &pc.RawPhone, &pc.DuplicateOf, &pc.CreatedAt); err != nil {
+			failErr(c, err)
+			return
+		}
+		conflicts = append(conflicts, pc)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conflicts)
+}
+
+// dismissPhoneConflict drops a reported conflict that needs no action.
+func (a *API) dismissPhoneConflict(c *gin.Context) {
+	id, ok := parseID(c, "phone conflict")
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var pc models.PhoneConflict
+	err = tx.QueryRow(
+		`DELETE FROM customer_phone_conflicts pc USING customers cu
+		 WHERE pc.id=$1 AND cu.id = pc.customer_id
+		 RETURNING pc.id, pc.customer_id, cu.name, pc.raw_phone, pc.duplicate_of, pc.created_at`,
+		id,
+	).Scan(&pc.ID, &pc.CustomerID, &pc.CustomerName, &pc.RawPhone, &pc.DuplicateOf, &pc.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "phone conflict not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditDelete, "phone_conflict", id, pc, nil); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// normalizePhone rewrites phone in E.164 form, answering 400 when it is not
+// a phone number.
+func (a *API) normalizePhone(c *gin.Context, phone string) (string, bool) {
+	normalized, err := validate.NormalizePhone(phone, a.phoneCountryCode)
+	if err != nil {
+		invalidField(c, "phone", "must be a phone number such as +1 555 010 1234")
+		return "", false
+	}
+	return normalized, true
+}
+
+// phoneTaken answers 409 when another customer than exceptID already has
+// phone. The response carries that customer, and its URL in Location, so
+// the client can use it instead of creating a duplicate.
+func phoneTaken(c *gin.Context, q rowQueryer, phone string, exceptID int64) bool {
+	if phone == "" {
+		return false
+	}
+	var existing models.Customer
+	err := q.QueryRow(
+		"SELECT id, name, COALESCE(phone, ''), version, created_at, archived_at FROM customers WHERE phone=$1 AND id<>$2",
+		phone, exceptID,
+	).Scan(&existing.ID, &existing.Name, &existing.Phone, &existing.Version, &existing.CreatedAt, &existing.ArchivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		failErr(c, err)
+		return true
+	}
+	c.Header("Location", fmt.Sprintf("/customers/%d", existing.ID))
+	c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+		"error": newAPIError(c, codeAlreadyExists, fmt.Sprintf("customer %d already has this phone number", existing.ID),
+			models.FieldError{Field: "phone", Message: "is already in use"}),
+		"customer": existing,
+	})
+	return true
+}
+
+// lockCustomerOrders locks the orders of a customer and returns their ids
+// in id order.
+func lockCustomerOrders(tx *sql.Tx, customerID int64) ([]int64, error) {
+	rows, err := tx.Query("SELECT id FROM orders WHERE customer_id=$1 ORDER BY id FOR UPDATE", customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// loadCustomer fetches one customer, locking its row when forUpdate is set.
+func loadCustomer(q rowQueryer, id int64, forUpdate bool) (models.Customer, error) {
+	query := "SELECT id, name, COALESCE(phone, ''), version, created_at, archived_at FROM customers WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var cu models.Customer
+	err := q.QueryRow(query, id).Scan(&cu.ID, &cu.Name, &cu.Phone, &cu.Version, &cu.CreatedAt, &cu.ArchivedAt)
+	return cu, err
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"terminal_store/pkg/models"
+	"terminal_store/pkg/validate"
+)
+
+// Error codes sent in models.APIError.Code. Clients may rely on them, so
+// existing codes must not change meaning.
+const (
+	codeInvalidRequest       = "invalid_request"
+	codeInvalidJSON          = "invalid_json"
+	codeValidation           = "validation_failed"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codeAlreadyExists        = "already_exists"
+	codeInsufficientStock    = "insufficient_stock"
+	codeVersionMismatch      = "version_mismatch"
+	codePreconditionRequired = "precondition_required"
+	codeIdempotencyMismatch  = "idempotency_key_reused"
+	codeIdempotencyBusy      = "idempotency_key_in_use"
+	codeInternal             = "internal_error"
+)
+
+func newAPIError(c *gin.Context, code, message string, details ...models.FieldError) *models.APIError {
+	return &models.APIError{Code: code, Message: message, Details: details, RequestID: c.GetString(ctxRequestID)}
+}
+
+// fail aborts the request with an error response.
+func fail(c *gin.Context, status int, code, message string, details ...models.FieldError) {
+	c.AbortWithStatusJSON(status, gin.H{"error": newAPIError(c, code, message, details...)})
+}
+
+// invalidField rejects a request because of one bad field.
+func invalidField(c *gin.Context, field, message string) {
+	fail(c, http.StatusBadRequest, codeValidation, "invalid request", models.FieldError{Field: field, Message: message})
+}
+
+// bindJSON decodes the request body into req, answering 400 with the
+// offending field when the body does not fit.
+func bindJSON(c *gin.Context, req any) bool {
+	err := c.ShouldBindBodyWithJSON(req)
+	if err == nil {
+		return true
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Type == reflect.TypeOf(models.Money(0)) {
+		invalidField(c, moneyField(c, typeErr.Value), "must be an amount with at most 2 decimal places")
+		return false
+	}
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		invalidField(c, typeErr.Field, "must be a "+typeErr.Type.String())
+		return false
+	}
+	fail(c, http.StatusBadRequest, codeInvalidJSON, "request body is not valid JSON")
+	return false
+}
+
+// moneyField names the top-level field of the request body that holds the
+// amount Money.UnmarshalJSON rejected as value. encoding/json does not say
+// which field an UnmarshalJSON error came from, so the body is searched
+// for it instead.
+func moneyField(c *gin.Context, value string) string {
+	body, _ := c.Get(gin.BodyBytesKey)
+	raw, _ := body.([]byte)
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return ""
+	}
+	names := slices.Sorted(maps.Keys(fields))
+	for _, name := range names {
+		text := string(fields[name])
+		if unquoted, err := strconv.Unquote(text); err == nil {
+			text = unquoted
+		}
+		if "amount "+text == value {
+			return name
+		}
+	}
+	return ""
+}
+
+// bindAndValidate decodes the request body into req and checks it against
+// its validate tags, answering 400 with every failing field at once.
+func bindAndValidate(c *gin.Context, req any) bool {
+	if !bindJSON(c, req) {
+		return false
+	}
+	if details := validate.Struct(req); len(details) > 0 {
+		fail(c, http.StatusBadRequest, codeValidation, "invalid request", details...)
+		return false
+	}
+	return true
+}
+
+// fieldError is returned by helpers that check a request against the
+// database, such as an option name the product does not have. failErr
+// reports it like a failed validation rule.
+type fieldError struct {
+	field   string
+	message string
+}
+
+func (e *fieldError) Error() string {
+	return e.field + " " + e.message
+}
+
+// failErr answers a request that failed with err. Stock shortfalls and
+// constraint violations are the client's fault and map to 4xx; anything
+// else is logged and reported without internals.
+func failErr(c *gin.Context, err error) {
+	var stockErr *stockError
+	if errors.As(err, &stockErr) {
+		fail(c, http.StatusConflict, codeInsufficientStock, stockErr.Error())
+		return
+	}
+	var variantErr *variantRequiredError
+	if errors.As(err, &variantErr) {
+		fail(c, http.StatusBadRequest, codeValidation, variantErr.Error(), models.FieldError{Field: "variant_id", Message: "is required"})
+		return
+	}
+	var fieldErr *fieldError
+	if errors.As(err, &fieldErr) {
+		invalidField(c, fieldErr.field, fieldErr.message)
+		return
+	}
+	if errors.Is(err, errVariantNotFound) {
+		fail(c, http.StatusNotFound, codeNotFound, "variant not found")
+		return
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23503": // foreign_key_violation
+			fail(c, http.StatusConflict, codeConflict, "a referenced record does not exist or is still in use")
+			return
+		case "23505": // unique_violation
+			fail(c, http.StatusConflict, codeAlreadyExists, "a record with these values already exists")
+			return
+		case "23514", "23502": // check_violation, not_null_violation
+			fail(c, http.StatusUnprocessableEntity, codeValidation, "the values break a data rule ("+pgErr.ConstraintName+")")
+			return
+		case "22P02", "22003", "22007", "22008": // invalid text, out of range, bad date/time
+			fail(c, http.StatusBadRequest, codeInvalidRequest, "a value has the wrong format or is out of range")
+			return
+		}
+	}
+	log.Printf("request %s: %v", c.GetString(ctxRequestID), err)
+	fail(c, http.StatusInternalServerError, codeInternal, "internal server error")
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+func TestBindAndValidate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		body string
+		want []models.FieldError // nil when the body is accepted
+	}{
+		{`{"name": "Mug", "price": "12.50"}`, nil},
+		{`{"name": "Mug", "price": 12.5}`, nil},
+		{`{"name": "Mug", "price": "12.505"}`, []models.FieldError{{Field: "price", Message: "must be an amount with at most 2 decimal places"}}},
+		{`{"name": "Mug", "price": 0.001}`, []models.FieldError{{Field: "price", Message: "must be an amount with at most 2 decimal places"}}},
+		{`{"name": " ", "price": "-1", "stock": -2}`, []models.FieldError{
+			{Field: "name", Message: "must not be blank"},
+			{Field: "price", Message: "must not be negative"},
+			{Field: "stock", Message: "must not be negative"},
+		}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(tt.body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		var req models.NewProduct
+		ok := bindAndValidate(c, &req)
+		if tt.want == nil {
+			if !ok {
+				t.Errorf("%s: rejected with %s", tt.body, w.Body)
+			}
+			continue
+		}
+		if ok || w.Code != http.StatusBadRequest {
+			t.Errorf("%s: accepted with status %d", tt.body, w.Code)
+			continue
+		}
+		var resp struct {
+			Error models.APIError `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: decoding response: %v", tt.body, err)
+			continue
+		}
+		if !slices.Equal(resp.Error.Details, tt.want) {
+			t.Errorf("%s: details = %v, want %v", tt.body, resp.Error.Details, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLen = 255
+
+// replayedHeaders are the response headers stored with an idempotent
+// response and sent again when it is replayed.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotencyTTLFromEnv reads IDEMPOTENCY_TTL as a Go duration ("24h",
+// "90m"). A missing or malformed value falls back to 24 hours.
+func idempotencyTTLFromEnv() time.Duration {
+	const fallback = 24 * time.Hour
+	text := os.Getenv("IDEMPOTENCY_TTL")
+	if text == "" {
+		return fallback
+	}
+	ttl, err := time.ParseDuration(text)
+	if err != nil || ttl <= 0 {
+		log.Printf("ignoring invalid IDEMPOTENCY_TTL %q", text)
+		return fallback
+	}
+	return ttl
+}
+
+// recordingWriter keeps a copy of everything the handler writes so it can
+// be stored for replay.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotent makes POST requests carrying an Idempotency-Key header safe to
+// retry. The first request with a key runs normally and its response is
+// stored; later requests with the same key, method and path get that
+// response back without running the handler again. Keys belong to the
+// user or API key that sent them, so callers cannot collide. Reusing a key for a
+// different body, or while the first request is still running, is a 409.
+// Server errors are not stored, so the client can retry them for real.
+func (a *API) idempotent(c *gin.Context) {
+	key := c.GetHeader("Idempotency-Key")
+	if c.Request.Method != http.MethodPost || key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "Idempotency-Key is too long")
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "could not read request body")
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	method, path := c.Request.Method, c.Request.URL.Path
+	actorType, actorID := requestActor(c)
+	actor := fmt.Sprintf("%s:%d", actorType, actorID)
+
+	// created_at is written by the database, so expire against its clock.
+	if _, err := a.db.Exec(
+		"DELETE FROM idempotency_keys WHERE created_at < NOW() - make_interval(secs => $1)",
+		a.idempotencyTTL.Seconds(),
+	); err != nil {
+		failErr(c, err)
+		return
+	}
+	res, err := a.db.Exec(
+		"INSERT INTO idempotency_keys (actor, key, method, path, request_hash) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+		actor, key, method, path, hash,
+	)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		a.replayIdempotent(c, actor, key, hash)
+		return
+	}
+
+	w := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	finished := false
+	defer func() {
+		// Free the key if the handler failed or panicked so a retry runs.
+		// A handler that answered below 500 may have committed, so its key
+		// is kept even if storing the response fails: a retry then gets a
+		// 409 rather than running the request twice.
+		if !finished || w.Status() >= http.StatusInternalServerError {
+			if _, err := a.db.Exec("DELETE FROM idempotency_keys WHERE actor=$1 AND key=$2 AND method=$3 AND path=$4", actor, key, method, path); err != nil {
+				log.Printf("releasing idempotency key %q: %v", key, err)
+			}
+		}
+	}()
+	c.Next()
+	finished = true
+
+	if status := w.Status(); status < http.StatusInternalServerError {
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if v := w.Header().Get(name); v != "" {
+				headers[name] = v
+			}
+		}
+		headersJSON, err := json.Marshal(headers)
+		if err != nil {
+			log.Printf("storing response for idempotency key %q: %v", key, err)
+			return
+		}
+		_, err = a.db.Exec(
+			"UPDATE idempotency_keys SET status=$1, response=$2, headers=$3 WHERE actor=$4 AND key=$5 AND method=$6 AND path=$7",
+			status, w.body.Bytes(), string(headersJSON), actor, key, method, path,
+		)
+		if err != nil {
+			log.Printf("storing response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// replayIdempotent answers a request whose key was already used.
+func (a *API) replayIdempotent(c *gin.Context, actor, key, hash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var response, headersJSON []byte
+	err := a.db.QueryRow(
+		"SELECT request_hash, status, response, headers FROM idempotency_keys WHERE actor=$1 AND key=$2 AND method=$3 AND path=$4",
+		actor, key, c.Request.Method, c.Request.URL.Path,
+	).Scan(&storedHash, &status, &response, &headersJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The first request failed and released the key in the meantime.
+		fail(c, http.StatusConflict, codeIdempotencyBusy, "a request with this Idempotency-Key just failed; retry it")
+		return
+	}
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	switch {
+	case storedHash != hash:
+		fail(c, http.StatusConflict, codeIdempotencyMismatch, "Idempotency-Key was already used for a different request")
+	case !status.Valid:
+		fail(c, http.StatusConflict, codeIdempotencyBusy, "a request with this Idempotency-Key is still in progress")
+	default:
+		headers := map[string]string{}
+		if err := json.Unmarshal(headersJSON, &headers); err != nil {
+			failErr(c, err)
+			return
+		}
+		contentType := "application/json; charset=utf-8"
+		for name, v := range headers {
+			if name == "Content-Type" {
+				contentType = v
+				continue
+			}
+			c.Header(name, v)
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(int(status.Int64), contentType, response)
+		c.Abort()
+	}
+}
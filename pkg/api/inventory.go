@@ -0,0 +1,234 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+// stockError is returned when a change would take more stock than a
+// product variant has.
+type stockError struct {
+	ProductID int64
+	VariantID int64
+	Have      int
+	Want      int
+}
+
+func (e *stockError) Error() string {
+	return fmt.Sprintf("insufficient stock for product %d (variant %d): have %d, want %d", e.ProductID, e.VariantID, e.Have, e.Want)
+}
+
+// variantRequiredError is returned when a stock change or sale names only
+// a product, but the product comes in several variants.
+type variantRequiredError struct {
+	ProductID int64
+}
+
+func (e *variantRequiredError) Error() string {
+	return fmt.Sprintf("product %d has several variants; choose one with variant_id", e.ProductID)
+}
+
+var errVariantNotFound = errors.New("variant not found")
+
+// applyMovement changes the stock of a product variant by m.Delta and
+// appends m to the inventory ledger, filling in its id, timestamp and the
+// product's resulting total stock. The movement is recorded as made by the
+// caller authenticated for c. Without m.VariantID the product's only
+// variant is used. It returns sql.ErrNoRows for an unknown product,
+// errVariantNotFound for a variant of another product, and a *stockError
+// when the stock would drop below zero. Every stock change goes through
+// here so the ledger always adds up to products.stock, and products.stock
+// to the sum of its variants.
+func applyMovement(tx *sql.Tx, c *gin.Context, m *models.InventoryMovement) error {
+	m.Actor = c.GetString(ctxActorName)
+	// The product row is locked first, as the order endpoints do, so the
+	// two cannot deadlock.
+	if _, err := loadProduct(tx, m.ProductID, true); err != nil {
+		return err
+	}
+	if m.VariantID == nil {
+		id, err := defaultVariant(tx, m.ProductID)
+		if err != nil {
+			return err
+		}
+		m.VariantID = &id
+	}
+	var variantStock int
+	err := tx.QueryRow(
+		"UPDATE product_variants SET stock = stock + $1 WHERE id=$2 AND product_id=$3 AND stock + $1 >= 0 RETURNING stock",
+		m.Delta, *m.VariantID, m.ProductID,
+	).Scan(&variantStock)
+	if errors.Is(err, sql.ErrNoRows) {
+		var have int
+		err := tx.QueryRow("SELECT stock FROM product_variants WHERE id=$1 AND product_id=$2", *m.VariantID, m.ProductID).Scan(&have)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errVariantNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return &stockError{ProductID: m.ProductID, VariantID: *m.VariantID, Have: have, Want: -m.Delta}
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow("UPDATE products SET stock = stock + $1 WHERE id=$2 RETURNING stock", m.Delta, m.ProductID).Scan(&m.StockAfter); err != nil {
+		return err
+	}
+	return tx.QueryRow(
+		`INSERT INTO inventory_movements (product_id, variant_id, delta, reason, actor, note, order_id, stock_after, opening)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
+		m.ProductID, m.VariantID, m.Delta, m.Reason, m.Actor, m.Note, m.OrderID, m.StockAfter, m.Opening,
+	).Scan(&m.ID, &m.CreatedAt)
+}
+
+// defaultVariant returns the id of a product's only variant. It returns
+// sql.ErrNoRows for an unknown product and a *variantRequiredError when
+// the product has several variants.
+func defaultVariant(q queryer, productID int64) (int64, error) {
+	rows, err := q.Query("SELECT id FROM product_variants WHERE product_id=$1 ORDER BY id LIMIT 2", productID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	switch len(ids) {
+	case 0:
+		return 0, sql.ErrNoRows
+	case 1:
+		return ids[0], nil
+	}
+	return 0, &variantRequiredError{ProductID: productID}
+}
+
+func (a *API) adjustStock(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	var req models.StockAdjustment
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadProduct(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	m := models.InventoryMovement{ProductID: id, VariantID: req.VariantID, Delta: req.Delta, Reason: req.Reason, Note: req.Note}
+	if err := applyMovement(tx, c, &m); err != nil {
+		failErr(c, err)
+		return
+	}
+	after, err := loadProduct(tx, id, false)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditAdjust, "product", id, before, after); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, m)
+}
+
+var movementSorts = map[string]sortField{
+	"id": {"id", "int"},
+}
+
+func (a *API) listMovements(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	pg, ok := parsePage(c, movementSorts, "-id")
+	if !ok {
+		return
+	}
+
+	var exists bool
+	if err := a.db.QueryRow("SELECT true FROM products WHERE id=$1", id).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+
+	var q listQuery
+	q.filter("product_id = " + q.arg(id))
+	if reason := models.MovementReason(c.Query("reason")); reason != "" {
+		if !reason.Valid() {
+			invalidField(c, "reason", "is not a known movement reason")
+			return
+		}
+		q.filter("reason = " + q.arg(reason))
+	}
+	variantID, ok := queryInt(c, "variant_id")
+	if !ok {
+		return
+	}
+	if variantID != nil {
+		q.filter("variant_id = " + q.arg(*variantID))
+	}
+
+	query := "SELECT id, product_id, variant_id, delta, reason, actor, note, order_id, stock_after, opening, created_at, " + pg.sort.column + "::text FROM inventory_movements" + q.build(pg, "id")
+	rows, err := a.db.Query(query, q.args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	movements := make([]models.InventoryMovement, 0)
+	keys := make([]pageCursor, 0)
+	for rows.Next() {
+		var m models.InventoryMovement
+		var key pageCursor
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.VariantID, &m.Delta, &m.Reason, &m.Actor, &m.Note, &m.OrderID, &m.StockAfter, &m.Opening, &m.CreatedAt, &key.Value); err != nil {
+			failErr(c, err)
+			return
+		}
+		key.ID = m.ID
+		movements = append(movements, m)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, finishPage(pg, movements, keys))
+}
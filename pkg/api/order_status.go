@@ -0,0 +1,206 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+type transitionOrderRequest struct {
+	Status models.OrderStatus `json:"status"`
+	Note   string             `json:"note"`
+}
+
+type cancelOrderRequest struct {
+	Note string `json:"note"`
+}
+
+func (a *API) transitionOrder(c *gin.Context) {
+	id, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+	var req transitionOrderRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !req.Status.Valid() {
+		invalidField(c, "status", "is not a known order status")
+		return
+	}
+
+	a.changeOrderStatus(c, id, req.Status, req.Note)
+}
+
+func (a *API) cancelOrder(c *gin.Context) {
+	id, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+	var req cancelOrderRequest
+	if c.Request.ContentLength != 0 {
+		if !bindJSON(c, &req) {
+			return
+		}
+	}
+	a.changeOrderStatus(c, id, models.OrderCancelled, req.Note)
+}
+
+// changeOrderStatus moves an order to the given status in one transaction,
+// returning cancelled stock to inventory, and responds with the updated order.
+func (a *API) changeOrderStatus(c *gin.Context, id int64, to models.OrderStatus, note string) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var current models.OrderStatus
+	if err := tx.QueryRow("SELECT status FROM orders WHERE id=$1 FOR UPDATE", id).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if current == to {
+		fail(c, http.StatusConflict, codeConflict, "order is already "+string(current))
+		return
+	}
+	if !current.CanTransitionTo(to) {
+		fail(c, http.StatusConflict, codeConflict, "cannot move order from "+string(current)+" to "+string(to))
+		return
+	}
+	before, err := loadOrder(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+
+	if to == models.OrderCancelled {
+		if err := restockOrder(tx, c, id); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	if _, err := tx.Exec("UPDATE orders SET status=$1 WHERE id=$2", to, id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordStatusChange(tx, id, current, to, note); err != nil {
+		failErr(c, err)
+		return
+	}
+	order, err := loadOrder(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditTransition, "order", id, before, order); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
+func (a *API) listOrderTransitions(c *gin.Context) {
+	id, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+
+	var exists bool
+	if err := a.db.QueryRow("SELECT true FROM orders WHERE id=$1", id).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+
+	rows, err := a.db.Query(
+		"SELECT id, order_id, COALESCE(from_status, ''), to_status, note, created_at FROM order_status_history WHERE order_id=$1 ORDER BY id",
+		id,
+	)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	changes := make([]models.OrderStatusChange, 0)
+	for rows.Next() {
+		var ch models.OrderStatusChange
+		if err := rows.Scan(&ch.ID, &ch.OrderID, &ch.FromStatus, &ch.ToStatus, &ch.Note, &ch.CreatedAt); err != nil {
+			failErr(c, err)
+			return
+		}
+		changes = append(changes, ch)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+// recordStatusChange appends a row to the order's status history. An empty
+// from status marks the order's creation.
+func recordStatusChange(tx *sql.Tx, orderID int64, from, to models.OrderStatus, note string) error {
+	_, err := tx.Exec(
+		"INSERT INTO order_status_history (order_id, from_status, to_status, note) VALUES ($1, NULLIF($2, ''), $3, $4)",
+		orderID, from, to, note,
+	)
+	return err
+}
+
+// restockOrder returns every item of the order that has not already been
+// returned to stock, recording each variant as a return in the inventory
+// ledger. Products are processed in id order so concurrent
+// cancellations lock rows in the same order and cannot deadlock.
+func restockOrder(tx *sql.Tx, c *gin.Context, orderID int64) error {
+	rows, err := tx.Query(`
+		SELECT oi.product_id, oi.variant_id,
+		       SUM(oi.qty - COALESCE((SELECT SUM(ri.qty) FROM return_items ri WHERE ri.order_item_id = oi.id), 0))
+		FROM order_items oi WHERE oi.order_id=$1
+		GROUP BY oi.product_id, oi.variant_id ORDER BY oi.product_id, oi.variant_id`,
+		orderID,
+	)
+	if err != nil {
+		return err
+	}
+	movements := make([]models.InventoryMovement, 0)
+	for rows.Next() {
+		m := models.InventoryMovement{Reason: models.MovementReturn, Note: "order cancelled", OrderID: &orderID}
+		if err := rows.Scan(&m.ProductID, &m.VariantID, &m.Delta); err != nil {
+			rows.Close()
+			return err
+		}
+		if m.Delta > 0 {
+			movements = append(movements, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range movements {
+		if err := applyMovement(tx, c, &movements[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,515 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+type updateOrderRequest struct {
+	CustomerID *int64 `json:"customer_id" validate:"omitnil,gt=0"`
+	Version    *int   `json:"version"`
+}
+
+var orderSorts = map[string]sortField{
+	"id":         {"id", "int"},
+	"created_at": {"created_at", "timestamp"},
+	"total":      {"total", "numeric"},
+}
+
+func (a *API) listOrders(c *gin.Context) {
+	pg, ok := parsePage(c, orderSorts, "id")
+	if !ok {
+		return
+	}
+	var q listQuery
+	customerID, ok := queryInt(c, "customer_id")
+	if !ok {
+		return
+	}
+	if customerID != nil {
+		q.filter("customer_id = " + q.arg(*customerID))
+	}
+	if status := models.OrderStatus(c.Query("status")); status != "" {
+		if !status.Valid() {
+			invalidField(c, "status", "is not a known order status")
+			return
+		}
+		q.filter("status = " + q.arg(status))
+	}
+	from, ok := queryTime(c, "created_from")
+	if !ok {
+		return
+	}
+	if from != nil {
+		q.filter("created_at >= " + q.arg(*from) + "::timestamptz::timestamp")
+	}
+	to, ok := queryTime(c, "created_to")
+	if !ok {
+		return
+	}
+	if to != nil {
+		q.filter("created_at < " + q.arg(*to) + "::timestamptz::timestamp")
+	}
+
+	query := "SELECT id, customer_id, status, subtotal, discount, tax, total, version, created_at, " + pg.sort.column + "::text FROM orders" + q.build(pg, "id")
+	rows, err := a.db.Query(query, q.args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	orders := make([]models.Order, 0)
+	keys := make([]pageCursor, 0)
+	for rows.Next() {
+		var o models.Order
+		var key pageCursor
+		if err := rows.Scan(&o.ID, &o.CustomerID, &o.Status, &o.Subtotal, &o.Discount, &o.Tax, &o.Total, &o.Version, &o.CreatedAt, &key.Value); err != nil {
+			failErr(c, err)
+			return
+		}
+		key.ID = o.ID
+		orders = append(orders, o)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	// Release the connection before loading items so a request never holds
+	// two connections from the pool at once.
+	rows.Close()
+
+	result := finishPage(pg, orders, keys)
+	if err := attachOrderItems(a.db, result.Data); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := attachOrderDiscounts(a.db, result.Data); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (a *API) getOrder(c *gin.Context) {
+	id, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+	order, err := loadOrder(a.db, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
+// updateOrder reassigns a pending order to another customer. Items and
+// status have their own endpoints.
+func (a *API) updateOrder(c *gin.Context) {
+	id, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+	var req updateOrderRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.CustomerID == nil {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "nothing to update")
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var status models.OrderStatus
+	var current int
+	if err := tx.QueryRow("SELECT status, version FROM orders WHERE id=$1 FOR UPDATE", id).Scan(&status, &current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, current, "order") {
+		return
+	}
+	if status != models.OrderPending {
+		fail(c, http.StatusConflict, codeConflict, "only pending orders can be edited")
+		return
+	}
+	before, err := loadOrder(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	var archived bool
+	if err := tx.QueryRow("SELECT archived_at IS NOT NULL FROM customers WHERE id=$1 FOR SHARE", *req.CustomerID).Scan(&archived); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "customer not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if archived {
+		fail(c, http.StatusConflict, codeConflict, "customer is archived")
+		return
+	}
+	// The order's discounts count against the new customer's
+	// per-customer limits from now on.
+	if *req.CustomerID != before.CustomerID {
+		name, err := perCustomerLimitReached(tx, id, *req.CustomerID)
+		if err != nil {
+			failErr(c, err)
+			return
+		}
+		if name != "" {
+			fail(c, http.StatusConflict, codeConflict, fmt.Sprintf("customer %d has already used promotion %q as often as it allows", *req.CustomerID, name))
+			return
+		}
+	}
+	if _, err := tx.Exec("UPDATE orders SET customer_id=$1 WHERE id=$2", *req.CustomerID, id); err != nil {
+		failErr(c, err)
+		return
+	}
+	order, err := loadOrder(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "order", id, before, order); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
+// deleteOrder removes a cancelled order together with its items and history.
+// Live orders must be cancelled first so their stock is returned.
+func (a *API) deleteOrder(c *gin.Context) {
+	id, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+	version, ok := expectedDeleteVersion(c)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var status models.OrderStatus
+	var current int
+	if err := tx.QueryRow("SELECT status, version FROM orders WHERE id=$1 FOR UPDATE", id).Scan(&status, &current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, current, "order") {
+		return
+	}
+	if status != models.OrderCancelled {
+		fail(c, http.StatusConflict, codeConflict, "only cancelled orders can be deleted")
+		return
+	}
+	before, err := loadOrder(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM orders WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditDelete, "order", id, before, nil); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// loadOrder fetches one order with its items.
+func loadOrder(q orderQueryer, id int64) (models.Order, error) {
+	var o models.Order
+	err := q.QueryRow("SELECT id, customer_id, status, subtotal, discount, tax, total, version, created_at FROM orders WHERE id=$1", id).
+		Scan(&o.ID, &o.CustomerID, &o.Status, &o.Subtotal, &o.Discount, &o.Tax, &o.Total, &o.Version, &o.CreatedAt)
+	if err != nil {
+		return o, err
+	}
+	orders := []models.Order{o}
+	if err := attachOrderItems(q, orders); err != nil {
+		return orders[0], err
+	}
+	err = attachOrderDiscounts(q, orders)
+	return orders[0], err
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+type orderQueryer interface {
+	rowQueryer
+	queryer
+}
+
+// attachOrderItems loads the items of all given orders with a single query,
+// however many orders there are, and fills in each order's Items.
+func attachOrderItems(q queryer, orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*models.Order, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		orders[i].Items = make([]models.OrderItem, 0)
+		byID[orders[i].ID] = &orders[i]
+	}
+
+	rows, err := q.Query(`
+		SELECT oi.id, oi.order_id, oi.product_id, oi.variant_id, oi.qty, oi.price_each, oi.line_total, oi.discount, oi.tax,
+		       COALESCE((SELECT SUM(ri.qty) FROM return_items ri WHERE ri.order_item_id = oi.id), 0)
+		FROM order_items oi WHERE oi.order_id = ANY($1) ORDER BY oi.order_id, oi.id`,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var it models.OrderItem
+		if err := rows.Scan(&it.ID, &it.OrderID, &it.ProductID, &it.VariantID, &it.Qty, &it.PriceEach, &it.LineTotal, &it.Discount, &it.Tax, &it.ReturnedQty); err != nil {
+			return err
+		}
+		o := byID[it.OrderID]
+		o.Items = append(o.Items, it)
+	}
+	return rows.Err()
+}
+
+func (a *API) createOrder(c *gin.Context) {
+	var req models.NewOrder
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var archived bool
+	if err := tx.QueryRow("SELECT archived_at IS NOT NULL FROM customers WHERE id=$1 FOR SHARE", req.CustomerID).Scan(&archived); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "customer not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if archived {
+		fail(c, http.StatusConflict, codeConflict, "customer is archived")
+		return
+	}
+
+	var order models.Order
+	order.CustomerID = req.CustomerID
+	if err := tx.QueryRow("INSERT INTO orders (customer_id) VALUES ($1) RETURNING id, status, created_at", req.CustomerID).Scan(&order.ID, &order.Status, &order.CreatedAt); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordStatusChange(tx, order.ID, "", order.Status, ""); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	productIDs := make([]int64, len(req.Items))
+	for i, it := range req.Items {
+		productIDs[i] = it.ProductID
+		if it.VariantID == 0 {
+			continue
+		}
+		var owner int64
+		err := tx.QueryRow("SELECT product_id FROM product_variants WHERE id=$1", it.VariantID).Scan(&owner)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				fail(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("variant %d not found", it.VariantID))
+				return
+			}
+			failErr(c, err)
+			return
+		}
+		if it.ProductID != 0 && it.ProductID != owner {
+			invalidField(c, fmt.Sprintf("items[%d].variant_id", i), fmt.Sprintf("is not a variant of product %d", it.ProductID))
+			return
+		}
+		productIDs[i] = owner
+	}
+	// Lock the products in id order, as restockOrder does, so concurrent
+	// orders wait for each other instead of deadlocking. The items are
+	// still processed, and listed, in the order they were given.
+	locking := slices.Clone(productIDs)
+	slices.Sort(locking)
+	if _, err := tx.Exec("SELECT id FROM products WHERE id = ANY($1) ORDER BY id FOR UPDATE", slices.Compact(locking)); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	order.Items = make([]models.OrderItem, 0, len(req.Items))
+	sold := make(map[int64]bool, len(req.Items))
+	for i, it := range req.Items {
+		productID, variantID := productIDs[i], it.VariantID
+		var price models.Money
+		var archived bool
+		// The price is the one in effect when the order is placed; within
+		// the transaction NOW() is the order's created_at.
+		err := tx.QueryRow("SELECT "+productPrice+", archived_at IS NOT NULL FROM products WHERE id=$1 FOR UPDATE", productID).Scan(&price, &archived)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				fail(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("product %d not found", productID))
+				return
+			}
+			failErr(c, err)
+			return
+		}
+		if archived {
+			fail(c, http.StatusConflict, codeConflict, fmt.Sprintf("product %d is archived", productID))
+			return
+		}
+		if variantID == 0 {
+			if variantID, err = defaultVariant(tx, productID); err != nil {
+				var variantErr *variantRequiredError
+				if errors.As(err, &variantErr) {
+					invalidField(c, fmt.Sprintf("items[%d].variant_id", i), fmt.Sprintf("is required; product %d comes in several variants", productID))
+					return
+				}
+				failErr(c, err)
+				return
+			}
+		}
+		// Naming the same variant once by product_id and once by variant_id
+		// slips past request validation.
+		if sold[variantID] {
+			invalidField(c, fmt.Sprintf("items[%d].variant_id", i), "repeats an earlier entry")
+			return
+		}
+		sold[variantID] = true
+		var override *models.Money
+		if err := tx.QueryRow("SELECT price FROM product_variants WHERE id=$1", variantID).Scan(&override); err != nil {
+			failErr(c, err)
+			return
+		}
+		if override != nil {
+			price = *override
+		}
+		sale := models.InventoryMovement{ProductID: productID, VariantID: &variantID, Delta: -it.Qty, Reason: models.MovementSale, OrderID: &order.ID}
+		if err := applyMovement(tx, c, &sale); err != nil {
+			failErr(c, err)
+			return
+		}
+		var item models.OrderItem
+		item.OrderID = order.ID
+		item.ProductID = productID
+		item.VariantID = variantID
+		item.Qty = it.Qty
+		item.PriceEach = price
+		item.LineTotal = price.Mul(it.Qty)
+		if err := tx.QueryRow(
+			"INSERT INTO order_items (order_id, product_id, variant_id, qty, price_each, line_total) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+			order.ID, productID, variantID, it.Qty, price, item.LineTotal,
+		).Scan(&item.ID); err != nil {
+			failErr(c, err)
+			return
+		}
+		order.Subtotal += item.LineTotal
+		order.Items = append(order.Items, item)
+	}
+
+	order.Discounts = make([]models.OrderDiscount, 0)
+	if err := applyPromotions(tx, &order, req.CouponCode); err != nil {
+		failErr(c, err)
+		return
+	}
+	order.Tax = (order.Subtotal - order.Discount).ApplyRate(a.taxRate)
+	order.Total = order.Subtotal - order.Discount + order.Tax
+	// Each line keeps its share of the discount and tax so a return can
+	// refund what was actually paid for it.
+	net := make([]models.Money, len(order.Items))
+	for i, it := range order.Items {
+		net[i] = it.LineTotal - it.Discount
+	}
+	for i, tax := range order.Tax.Split(net) {
+		it := &order.Items[i]
+		it.Tax = tax
+		if _, err := tx.Exec("UPDATE order_items SET discount=$1, tax=$2 WHERE id=$3", it.Discount, it.Tax, it.ID); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	if err := tx.QueryRow(
+		"UPDATE orders SET subtotal=$1, discount=$2, tax=$3, total=$4 WHERE id=$5 RETURNING version",
+		order.Subtotal, order.Discount, order.Tax, order.Total, order.ID,
+	).Scan(&order.Version); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "order", order.ID, nil, order); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, order.Version)
+	c.JSON(http.StatusCreated, order)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+// fakeStore answers the queries of listOrders from memory and counts
+// them. It serves orders 1..orders, each with itemsPerOrder items.
+type fakeStore struct {
+	orders        int
+	itemsPerOrder int
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func (s *fakeStore) Connect(context.Context) (driver.Conn, error) { return &fakeConn{s}, nil }
+func (s *fakeStore) Driver() driver.Driver                        { return fakeDriver{} }
+
+func (s *fakeStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queries)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("open the fake store with sql.OpenDB")
+}
+
+type fakeConn struct{ store *fakeStore }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// CheckNamedValue passes every argument through as is, so slices such as
+// the []int64 of "= ANY($1)" reach QueryContext.
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.store
+	s.mu.Lock()
+	s.queries = append(s.queries, query)
+	s.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "FROM order_items"):
+		rows := &fakeRows{columns: make([]string, 10)}
+		for _, orderID := range args[0].Value.([]int64) {
+			for i := range s.itemsPerOrder {
+				itemID := orderID*100 + int64(i)
+				rows.values = append(rows.values, []driver.Value{itemID, orderID, int64(1), int64(1), int64(2), "5.00", "10.00", "0.00", "0.83", int64(0)})
+			}
+		}
+		return rows, nil
+	case strings.Contains(query, "FROM order_discounts"):
+		return &fakeRows{columns: make([]string, 6)}, nil
+	case strings.Contains(query, "FROM orders"):
+		rows := &fakeRows{columns: make([]string, 10)}
+		created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		for id := int64(1); id <= int64(s.orders); id++ {
+			rows.values = append(rows.values, []driver.Value{id, int64(7), "pending", "20.00", "0.00", "1.65", "21.65", int64(1), created, "1"})
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// TestListOrdersQueryCount guards against loading items or discounts per
+// order: a page costs the same number of queries however many orders it
+// holds.
+func TestListOrdersQueryCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	counts := make(map[int]int)
+	for _, n := range []int{1, 40} {
+		store := &fakeStore{orders: n, itemsPerOrder: 3}
+		db := sql.OpenDB(store)
+		defer db.Close()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/orders?limit=100", nil)
+		(&API{db: db}).listOrders(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%d orders: status %d: %s", n, w.Code, w.Body)
+		}
+		var page models.Page[models.Order]
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("%d orders: decoding response: %v", n, err)
+		}
+		if len(page.Data) != n {
+			t.Fatalf("%d orders: got %d orders", n, len(page.Data))
+		}
+		for _, o := range page.Data {
+			if len(o.Items) != store.itemsPerOrder {
+				t.Errorf("%d orders: order %d has %d items, want %d", n, o.ID, len(o.Items), store.itemsPerOrder)
+			}
+		}
+		counts[n] = store.count()
+	}
+	if counts[1] != counts[40] {
+		t.Errorf("listOrders ran %d queries for 1 order but %d for 40", counts[1], counts[40])
+	}
+	if counts[1] != 3 {
+		t.Errorf("listOrders ran %d queries, want 3 (orders, items, discounts)", counts[1])
+	}
+}
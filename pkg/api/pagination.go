@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// sortField is a column clients may sort a list by. The cast is the SQL type
+// the column's text form is converted back to when comparing against a cursor.
+type sortField struct {
+	column string
+	cast   string
+}
+
+// page holds the parsed limit, sort and after parameters of a list request.
+type page struct {
+	limit   int
+	sortKey string
+	sort    sortField
+	desc    bool
+	after   *pageCursor
+}
+
+// pageCursor marks the last row of a page: the text form of its sort column
+// and its id as a tie-breaker. The sort key is kept so a cursor cannot be
+// replayed against a different ordering.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func encodeCursor(cur pageCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(text string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+	var cur pageCursor
+	if err := json.Unmarshal(b, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+// parsePage reads limit, sort and after from the query string. Sort accepts
+// a key from fields, prefixed with "-" for descending order.
+func parsePage(c *gin.Context, fields map[string]sortField, defaultSort string) (page, bool) {
+	pg := page{limit: defaultPageSize}
+
+	if text := c.Query("limit"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n <= 0 {
+			invalidField(c, "limit", "must be a positive integer")
+			return pg, false
+		}
+		pg.limit = min(n, maxPageSize)
+	}
+
+	pg.sortKey = c.DefaultQuery("sort", defaultSort)
+	key := strings.TrimPrefix(pg.sortKey, "-")
+	pg.desc = key != pg.sortKey
+	field, ok := fields[key]
+	if !ok {
+		invalidField(c, "sort", "cannot sort by "+key)
+		return pg, false
+	}
+	pg.sort = field
+
+	if text := c.Query("after"); text != "" {
+		cur, err := decodeCursor(text)
+		if err != nil || cur.Sort != pg.sortKey {
+			invalidField(c, "after", "is not a valid cursor")
+			return pg, false
+		}
+		pg.after = cur
+	}
+	return pg, true
+}
+
+// listQuery accumulates WHERE conditions and their positional arguments.
+type listQuery struct {
+	where []string
+	args  []any
+}
+
+// arg appends a query argument and returns its placeholder.
+func (q *listQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *listQuery) filter(cond string) {
+	q.where = append(q.where, cond)
+}
+
+// build returns the WHERE, ORDER BY and LIMIT clauses for a page. One extra
+// row is requested so the caller can tell whether another page follows.
+func (q *listQuery) build(pg page, idColumn string) string {
+	cmp, dir := ">", "ASC"
+	if pg.desc {
+		cmp, dir = "<", "DESC"
+	}
+	if pg.after != nil {
+		q.filter("(" + pg.sort.column + ", " + idColumn + ") " + cmp +
+			" (" + q.arg(pg.after.Value) + "::" + pg.sort.cast + ", " + q.arg(pg.after.ID) + ")")
+	}
+
+	var sb strings.Builder
+	if len(q.where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(q.where, " AND "))
+	}
+	sb.WriteString(" ORDER BY " + pg.sort.column + " " + dir + ", " + idColumn + " " + dir)
+	sb.WriteString(" LIMIT " + strconv.Itoa(pg.limit+1))
+	return sb.String()
+}
+
+// finishPage trims the lookahead row and wraps the items in a response
+// envelope. keys holds the sort value text and id of each scanned row.
+func finishPage[T any](pg page, items []T, keys []pageCursor) models.Page[T] {
+	if len(items) <= pg.limit {
+		return models.Page[T]{Data: items}
+	}
+	last := keys[pg.limit-1]
+	last.Sort = pg.sortKey
+	return models.Page[T]{Data: items[:pg.limit], NextCursor: encodeCursor(last)}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// prefixPattern returns an ILIKE pattern matching values starting with s.
+func prefixPattern(s string) string {
+	return likeEscaper.Replace(s) + "%"
+}
+
+// containsPattern returns an ILIKE pattern matching values containing s.
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// queryInt parses an optional integer query parameter. It returns nil when
+// the parameter is absent.
+func queryInt(c *gin.Context, name string) (*int64, bool) {
+	text := c.Query(name)
+	if text == "" {
+		return nil, true
+	}
+	v, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		invalidField(c, name, "must be an integer")
+		return nil, false
+	}
+	return &v, true
+}
+
+// queryTime parses an optional date (2006-01-02) or RFC 3339 timestamp query
+// parameter. It returns nil when the parameter is absent, or else text for
+// a "::timestamptz::timestamp" cast: a timestamp keeps its offset, so it
+// compares with TIMESTAMP columns in the database's time zone, which is
+// the one NOW() wrote them in, and a date is midnight in that zone.
+func queryTime(c *gin.Context, name string) (*string, bool) {
+	text := c.Query(name)
+	if text == "" {
+		return nil, true
+	}
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		text = t.Format(time.RFC3339Nano)
+		return &text, true
+	}
+	if _, err := time.Parse(time.DateOnly, text); err != nil {
+		invalidField(c, name, "must be a date or RFC 3339 timestamp")
+		return nil, false
+	}
+	return &text, true
+}
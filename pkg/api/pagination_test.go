@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, cur := range []pageCursor{
+		{Sort: "id", Value: "42", ID: 42},
+		{Sort: "-created_at", Value: "2026-01-02 03:04:05.123456", ID: 7},
+		{Sort: "name", Value: "Ünïcode & \"quotes\"", ID: 1},
+		{Sort: "price", Value: "", ID: 3},
+	} {
+		text := encodeCursor(cur)
+		got, err := decodeCursor(text)
+		if err != nil {
+			t.Errorf("decodeCursor(encodeCursor(%+v)): %v", cur, err)
+			continue
+		}
+		if *got != cur {
+			t.Errorf("cursor %+v came back as %+v", cur, *got)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, text := range []string{"not base64!", "e30=", "bm90IGpzb24"} {
+		if cur, err := decodeCursor(text); err == nil {
+			t.Errorf("decodeCursor(%q) = %+v, want an error", text, *cur)
+		}
+	}
+}
+
+func TestQueryTime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"2026-03-04", "2026-03-04"},
+		{"2026-03-04T10:00:00%2B02:00", "2026-03-04T10:00:00+02:00"},
+		{"2026-03-04T10:00:00.5Z", "2026-03-04T10:00:00.5Z"},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?from="+tt.query, nil)
+		got, ok := queryTime(c, "from")
+		if !ok || got == nil || *got != tt.want {
+			t.Errorf("queryTime(%q) = %v, %v; want %q", tt.query, got, ok, tt.want)
+		}
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?from=yesterday", nil)
+	if _, ok := queryTime(c, "from"); ok || w.Code != http.StatusBadRequest {
+		t.Errorf("queryTime(yesterday) = %v with status %d, want a 400", ok, w.Code)
+	}
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+// productPrice is the price in effect now for the products row of the
+// enclosing query, taken from its price history. products.price only
+// stands in for products that somehow have no history.
+const productPrice = `COALESCE((SELECT pp.price FROM product_prices pp
+	WHERE pp.product_id = products.id AND pp.effective_from <= NOW()
+	  AND (pp.effective_to IS NULL OR pp.effective_to > NOW())), products.price)`
+
+// schedulePriceRequest sets a new price from EffectiveFrom, or right away
+// when it is left out. With EffectiveTo the price is temporary and the
+// price before it applies again afterwards; without it the price holds
+// until the next scheduled change, if any. Version is the product version
+// the change is based on, when If-Match is not sent.
+type schedulePriceRequest struct {
+	Price         models.Money `json:"price" validate:"min=0"`
+	EffectiveFrom *time.Time   `json:"effective_from"`
+	EffectiveTo   *time.Time   `json:"effective_to"`
+	Version       *int         `json:"version"`
+}
+
+// priceClockSkew is how far in the past effective_from may be and still be
+// taken as now.
+const priceClockSkew = 5 * time.Minute
+
+var errPriceOverlap = errors.New("another price change is scheduled within this period")
+
+// listPrices returns a product's price history and scheduled changes,
+// oldest first.
+func (a *API) listPrices(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	if _, err := loadProduct(a.db, id, false); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	rows, err := a.db.Query(
+		"SELECT id, product_id, price, effective_from, effective_to, created_at FROM product_prices WHERE product_id=$1 ORDER BY effective_from",
+		id,
+	)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	prices := make([]models.ProductPrice, 0)
+	for rows.Next() {
+		var pp models.ProductPrice
+		if err := rows.Scan(&pp.ID, &pp.ProductID, &pp.Price, &pp.EffectiveFrom, &pp.EffectiveTo, &pp.CreatedAt); err != nil {
+			failErr(c, err)
+			return
+		}
+		prices = append(prices, pp)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prices)
+}
+
+func (a *API) schedulePrice(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	var req schedulePriceRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, err := loadProduct(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, p.Version, "product") {
+		return
+	}
+	pp, err := setPrice(tx, id, req.Price, req.EffectiveFrom, req.EffectiveTo)
+	if err != nil {
+		if errors.Is(err, errPriceOverlap) {
+			fail(c, http.StatusConflict, codeConflict, err.Error())
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	// A price scheduled for later leaves products.price alone, so the
+	// version is moved explicitly: the change is still an edit of the
+	// product that other clients' If-Match must notice.
+	if _, err := tx.Exec("UPDATE products SET price="+productPrice+", version=version+1 WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	after, err := loadProduct(tx, id, false)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "product", id, gin.H{"price": p.Price}, gin.H{"price": after.Price, "scheduled": pp}); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, after.Version)
+	c.JSON(http.StatusCreated, pp)
+}
+
+// setPrice records price in a product's history from the time from (now
+// when nil) until to (until the next scheduled change when nil), cutting
+// short the entry in effect at that time. The product row must be locked.
+// The caller brings products.price up to the price now in effect, in the
+// same write that moves the product's version. It returns errPriceOverlap
+// when another change starts within the period.
+func setPrice(tx *sql.Tx, productID int64, price models.Money, from, to *time.Time) (models.ProductPrice, error) {
+	pp := models.ProductPrice{ProductID: productID, Price: price}
+	var now time.Time
+	if err := tx.QueryRow("SELECT NOW()").Scan(&now); err != nil {
+		return pp, err
+	}
+	pp.EffectiveFrom = now
+	if from != nil {
+		// A time just behind the database clock is a client running a
+		// little slow, or "now" sent by a slow request; it means now.
+		if from.Before(now.Add(-priceClockSkew)) {
+			return pp, &fieldError{"effective_from", "must not be in the past"}
+		}
+		if from.After(now) {
+			pp.EffectiveFrom = *from
+		}
+	}
+	if to != nil && !to.After(pp.EffectiveFrom) {
+		return pp, &fieldError{"effective_to", "must be after effective_from"}
+	}
+
+	var overlap bool
+	err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM product_prices WHERE product_id=$1 AND effective_from >= $2
+		   AND (effective_from = $2 OR effective_from < $3))`,
+		productID, pp.EffectiveFrom, to,
+	).Scan(&overlap)
+	if err != nil {
+		return pp, err
+	}
+	if overlap {
+		return pp, errPriceOverlap
+	}
+	pp.EffectiveTo = to
+	if to == nil {
+		if err := tx.QueryRow(
+			"SELECT MIN(effective_from) FROM product_prices WHERE product_id=$1 AND effective_from > $2",
+			productID, pp.EffectiveFrom,
+		).Scan(&pp.EffectiveTo); err != nil {
+			return pp, err
+		}
+	}
+
+	var coveringID int64
+	var coveringPrice models.Money
+	var coveringTo *time.Time
+	err = tx.QueryRow(
+		`SELECT id, price, effective_to FROM product_prices
+		 WHERE product_id=$1 AND effective_from < $2 AND (effective_to IS NULL OR effective_to > $2)`,
+		productID, pp.EffectiveFrom,
+	).Scan(&coveringID, &coveringPrice, &coveringTo)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return pp, err
+	default:
+		if _, err := tx.Exec("UPDATE product_prices SET effective_to=$1 WHERE id=$2", pp.EffectiveFrom, coveringID); err != nil {
+			return pp, err
+		}
+		// After a temporary price the earlier price resumes.
+		if to != nil && (coveringTo == nil || coveringTo.After(*to)) {
+			if _, err := tx.Exec(
+				"INSERT INTO product_prices (product_id, price, effective_from, effective_to) VALUES ($1, $2, $3, $4)",
+				productID, coveringPrice, *to, coveringTo,
+			); err != nil {
+				return pp, err
+			}
+		}
+	}
+
+	err = tx.QueryRow(
+		"INSERT INTO product_prices (product_id, price, effective_from, effective_to) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		productID, price, pp.EffectiveFrom, pp.EffectiveTo,
+	).Scan(&pp.ID, &pp.CreatedAt)
+	if err != nil {
+		return pp, err
+	}
+	return pp, nil
+}
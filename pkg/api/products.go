@@ -0,0 +1,544 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+	"terminal_store/pkg/validate"
+)
+
+type updateProductRequest struct {
+	Name    *string       `json:"name" validate:"omitnil,notblank,max=100"`
+	SKU     *string       `json:"sku" validate:"omitnil,max=40,printascii"`
+	Barcode *string       `json:"barcode" validate:"omitnil,barcode"`
+	Price   *models.Money `json:"price" validate:"omitnil,min=0"`
+	Version *int          `json:"version"`
+}
+
+// updateStockRequest sets the stock of one variant; VariantID may be left
+// out for a product with a single variant.
+type updateStockRequest struct {
+	VariantID *int64 `json:"variant_id" validate:"omitnil,gt=0"`
+	Stock     int    `json:"stock" validate:"min=0"`
+	Note      string `json:"note"`
+	Version   *int   `json:"version"`
+}
+
+// productMatch is one result of a product search. Rank runs from 0 to 1,
+// higher for better matches; Highlight is the name with the matched words
+// wrapped in [brackets].
+type productMatch struct {
+	models.Product
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+// productColumns are the columns scanned by productFields, in order.
+const productColumns = "id, name, COALESCE(sku, ''), COALESCE(barcode, ''), " + productPrice + ", stock, version, created_at, archived_at"
+
+// productFields returns pointers to the fields of p that productColumns
+// fill, followed by extra.
+func productFields(p *models.Product, extra ...any) []any {
+	return append([]any{&p.ID, &p.Name, &p.SKU, &p.Barcode, &p.Price, &p.Stock, &p.Version, &p.CreatedAt, &p.ArchivedAt}, extra...)
+}
+
+const (
+	productSearchLimit    = 20
+	productSearchMaxLimit = 100
+)
+
+var productSorts = map[string]sortField{
+	"id":         {"id", "int"},
+	"name":       {"name", "text"},
+	"price":      {productPrice, "numeric"},
+	"stock":      {"stock", "int"},
+	"created_at": {"created_at", "timestamp"},
+}
+
+func (a *API) listProducts(c *gin.Context) {
+	pg, ok := parsePage(c, productSorts, "id")
+	if !ok {
+		return
+	}
+	var q listQuery
+	if c.Query("include_archived") != "true" {
+		q.filter("archived_at IS NULL")
+	}
+	if prefix := c.Query("name_prefix"); prefix != "" {
+		q.filter("name ILIKE " + q.arg(prefixPattern(prefix)))
+	}
+	minStock, ok := queryInt(c, "min_stock")
+	if !ok {
+		return
+	}
+	if minStock != nil {
+		q.filter("stock >= " + q.arg(*minStock))
+	}
+	maxStock, ok := queryInt(c, "max_stock")
+	if !ok {
+		return
+	}
+	if maxStock != nil {
+		q.filter("stock <= " + q.arg(*maxStock))
+	}
+	// A category includes the products of every category below it.
+	category, ok := queryInt(c, "category")
+	if !ok {
+		return
+	}
+	if category != nil {
+		q.filter("id IN (SELECT product_id FROM product_categories WHERE category_id IN (" + categorySubtree(q.arg(*category)) + "))")
+	}
+
+	query := "SELECT " + productColumns + ", " + pg.sort.column + "::text FROM products" + q.build(pg, "id")
+	rows, err := a.db.Query(query, q.args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	products := make([]models.Product, 0)
+	keys := make([]pageCursor, 0)
+	for rows.Next() {
+		var p models.Product
+		var key pageCursor
+		if err := rows.Scan(productFields(&p, &key.Value)...); err != nil {
+			failErr(c, err)
+			return
+		}
+		key.ID = p.ID
+		products = append(products, p)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, finishPage(pg, products, keys))
+}
+
+// searchProducts finds products by the words of q, best matches first.
+// Whole words match in any order and form; names that merely contain q, or
+// are spelled slightly differently, are found too.
+func (a *API) searchProducts(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		invalidField(c, "q", "is required")
+		return
+	}
+	limit, ok := queryInt(c, "limit")
+	if !ok {
+		return
+	}
+	n := int64(productSearchLimit)
+	if limit != nil {
+		if *limit < 1 || *limit > productSearchMaxLimit {
+			invalidField(c, "limit", fmt.Sprintf("must be between 1 and %d", productSearchMaxLimit))
+			return
+		}
+		n = *limit
+	}
+	archived := " AND archived_at IS NULL"
+	if c.Query("include_archived") == "true" {
+		archived = ""
+	}
+
+	rows, err := a.db.Query(`
+		WITH q AS (SELECT websearch_to_tsquery('english', $1) AS tsq)
+		SELECT `+productColumns+`,
+		       GREATEST(
+		         ts_rank(search, q.tsq, 1),
+		         similarity(name, $1),
+		         CASE WHEN name ILIKE $2 THEN 0.5 ELSE 0 END,
+		         CASE WHEN sku = $1 OR barcode = $1 THEN 1 ELSE 0 END
+		       )::float8 AS rank,
+		       ts_headline('english', name, q.tsq, 'StartSel=[, StopSel=], HighlightAll=true')
+		FROM products, q
+		WHERE (search @@ q.tsq OR name ILIKE $2 OR name % $1 OR sku = $1 OR barcode = $1)`+archived+`
+		ORDER BY rank DESC, name, id
+		LIMIT $3`,
+		q, containsPattern(q), n,
+	)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	matches := make([]productMatch, 0)
+	for rows.Next() {
+		var m productMatch
+		if err := rows.Scan(productFields(&m.Product, &m.Rank, &m.Highlight)...); err != nil {
+			failErr(c, err)
+			return
+		}
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
+func (a *API) createProduct(c *gin.Context) {
+	var req models.NewProduct
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	req.Barcode, _ = validate.NormalizeBarcode(req.Barcode)
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var p models.Product
+	p.Name = req.Name
+	p.SKU = req.SKU
+	p.Barcode = req.Barcode
+	p.Price = req.Price
+	if skuTaken(c, tx, p.SKU, 0, 0) {
+		return
+	}
+	err = tx.QueryRow(
+		"INSERT INTO products (name, sku, barcode, price, stock) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, 0) RETURNING id, version, created_at",
+		p.Name, p.SKU, p.Barcode, p.Price,
+	).Scan(&p.ID, &p.Version, &p.CreatedAt)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	// Every product starts with one plain variant that holds its stock
+	// until options and further variants are added.
+	if _, err := tx.Exec("INSERT INTO product_variants (product_id) VALUES ($1)", p.ID); err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO product_prices (product_id, price, effective_from) VALUES ($1, $2, NOW())", p.ID, p.Price); err != nil {
+		failErr(c, err)
+		return
+	}
+	if req.Stock > 0 {
+		m := models.InventoryMovement{ProductID: p.ID, Delta: req.Stock, Reason: models.MovementRestock, Note: "initial stock", Opening: true}
+		if err := applyMovement(tx, c, &m); err != nil {
+			failErr(c, err)
+			return
+		}
+		// Stock does not move the version, so the product is read back
+		// rather than assumed to be at a later one.
+		if p, err = loadProduct(tx, p.ID, false); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	if err := recordAudit(tx, c, auditCreate, "product", p.ID, nil, p); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusCreated, p)
+}
+
+func (a *API) getProduct(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	p, err := loadProduct(a.db, id, false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	setETag(c, p.Version)
+	c.JSON(http.StatusOK, p)
+}
+
+func (a *API) updateProduct(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	var req updateProductRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.Name == nil && req.SKU == nil && req.Barcode == nil && req.Price == nil {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "nothing to update")
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, err := loadProduct(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, p.Version, "product") {
+		return
+	}
+	before := p
+	if req.Name != nil {
+		p.Name = *req.Name
+	}
+	if req.SKU != nil {
+		if skuTaken(c, tx, *req.SKU, id, 0) {
+			return
+		}
+		p.SKU = *req.SKU
+	}
+	if req.Barcode != nil {
+		p.Barcode, _ = validate.NormalizeBarcode(*req.Barcode)
+	}
+	// A new price applies from now on and goes into the price history;
+	// POST /products/:id/prices schedules one for later.
+	if req.Price != nil && *req.Price != p.Price {
+		if _, err := setPrice(tx, id, *req.Price, nil, nil); err != nil {
+			if errors.Is(err, errPriceOverlap) {
+				fail(c, http.StatusConflict, codeConflict, err.Error())
+				return
+			}
+			failErr(c, err)
+			return
+		}
+		p.Price = *req.Price
+	}
+	// One write for every field, so the version moves once per edit.
+	// Reads go through productPrice; price is its fallback and takes the
+	// price now in effect, including any change scheduled earlier.
+	if err := tx.QueryRow(
+		"UPDATE products SET name=$1, sku=NULLIF($2, ''), barcode=NULLIF($3, ''), price="+productPrice+" WHERE id=$4 RETURNING version",
+		p.Name, p.SKU, p.Barcode, id,
+	).Scan(&p.Version); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "product", id, before, p); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusOK, p)
+}
+
+func (a *API) deleteProduct(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	version, ok := expectedDeleteVersion(c)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, err := loadProduct(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, p.Version, "product") {
+		return
+	}
+	// A product can only be deleted while nothing has happened to it: no
+	// order has used it and its stock has not moved since the product and
+	// its variants were created. The opening entries that stocked them are
+	// deleted with it; any other movement is history, so archive the
+	// product instead.
+	var sold, moved bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM order_items WHERE product_id=$1),
+		EXISTS (SELECT 1 FROM inventory_movements WHERE product_id=$1 AND NOT opening)`, id).Scan(&sold, &moved); err != nil {
+		failErr(c, err)
+		return
+	}
+	if sold {
+		fail(c, http.StatusConflict, codeConflict, "product has order history; archive it instead")
+		return
+	}
+	if moved {
+		fail(c, http.StatusConflict, codeConflict, "product has stock history; archive it instead")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM inventory_movements WHERE product_id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM products WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditDelete, "product", id, p, nil); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (a *API) updateStock(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	var req updateStockRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, err := loadProduct(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, p.Version, "product") {
+		return
+	}
+	variantID := req.VariantID
+	if variantID == nil {
+		id, err := defaultVariant(tx, p.ID)
+		if err != nil {
+			failErr(c, err)
+			return
+		}
+		variantID = &id
+	}
+	var have int
+	err = tx.QueryRow("SELECT stock FROM product_variants WHERE id=$1 AND product_id=$2 FOR UPDATE", *variantID, id).Scan(&have)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errVariantNotFound
+	}
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	// A recount is recorded as a correction for the difference, so the
+	// ledger still explains the new absolute value.
+	before := p
+	if delta := req.Stock - have; delta != 0 {
+		m := models.InventoryMovement{ProductID: id, VariantID: variantID, Delta: delta, Reason: models.MovementCorrection, Note: req.Note}
+		if err := applyMovement(tx, c, &m); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	// Stock alone does not move the version, but an absolute value is
+	// based on what the client read: a second recount made from the same
+	// read must fail its If-Match instead of overwriting this one.
+	if _, err := tx.Exec("UPDATE products SET version = version + 1 WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if p, err = loadProduct(tx, id, false); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "product", id, before, p); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusOK, p)
+}
+
+// getProductByBarcode looks a product up by the barcode printed on it, as
+// typed by a scanner. A UPC-A finds the product stored under its EAN-13.
+func (a *API) getProductByBarcode(c *gin.Context) {
+	code, err := validate.NormalizeBarcode(c.Param("code"))
+	if err != nil || code == "" {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "invalid barcode")
+		return
+	}
+	var p models.Product
+	err = a.db.QueryRow("SELECT "+productColumns+" FROM products WHERE barcode=$1", code).Scan(productFields(&p)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "no product has barcode "+code)
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	setETag(c, p.Version)
+	c.JSON(http.StatusOK, p)
+}
+
+// loadProduct fetches one product, locking its row when forUpdate is set.
+func loadProduct(q rowQueryer, id int64, forUpdate bool) (models.Product, error) {
+	query := "SELECT " + productColumns + " FROM products WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var p models.Product
+	err := q.QueryRow(query, id).Scan(productFields(&p)...)
+	return p, err
+}
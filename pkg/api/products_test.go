@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stockStore answers the queries of updateStock for product 1 and its only
+// variant 10 from memory. A transaction holds the product for its whole
+// life, as the FOR UPDATE of loadProduct does, and like the database a
+// stock change alone does not move the version.
+type stockStore struct {
+	lock sync.Mutex // held by the open transaction
+
+	mu      sync.Mutex
+	stock   int
+	version int
+	saved   [2]int // stock and version when the transaction began
+}
+
+func (s *stockStore) Connect(context.Context) (driver.Conn, error) { return &stockConn{s}, nil }
+func (s *stockStore) Driver() driver.Driver                        { return fakeDriver{} }
+
+type stockConn struct{ store *stockStore }
+
+func (c *stockConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *stockConn) Close() error                        { return nil }
+
+func (c *stockConn) Begin() (driver.Tx, error) {
+	s := c.store
+	s.lock.Lock()
+	s.mu.Lock()
+	s.saved = [2]int{s.stock, s.version}
+	s.mu.Unlock()
+	return &stockTx{s}, nil
+}
+
+type stockTx struct{ store *stockStore }
+
+func (tx *stockTx) Commit() error {
+	tx.store.lock.Unlock()
+	return nil
+}
+
+func (tx *stockTx) Rollback() error {
+	s := tx.store
+	s.mu.Lock()
+	s.stock, s.version = s.saved[0], s.saved[1]
+	s.mu.Unlock()
+	s.lock.Unlock()
+	return nil
+}
+
+func (c *stockConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	one := func(values ...driver.Value) driver.Rows {
+		return &fakeRows{columns: make([]string, len(values)), values: [][]driver.Value{values}}
+	}
+	switch {
+	case strings.Contains(query, "FROM products WHERE id=$1"):
+		return one(int64(1), "Mug", "", "", "5.00", int64(s.stock), int64(s.version), time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), nil), nil
+	case strings.HasPrefix(query, "SELECT id FROM product_variants"):
+		return one(int64(10)), nil
+	case strings.HasPrefix(query, "SELECT stock FROM product_variants"):
+		return one(int64(s.stock)), nil
+	case strings.HasPrefix(query, "UPDATE product_variants SET stock"):
+		s.stock += int(args[0].Value.(int64))
+		return one(int64(s.stock)), nil
+	case strings.HasPrefix(query, "UPDATE products SET stock"):
+		return one(int64(s.stock)), nil
+	case strings.Contains(query, "INSERT INTO inventory_movements"):
+		return one(int64(1), time.Now()), nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+func (c *stockConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "UPDATE products SET version = version + 1"):
+		s.version++
+	case strings.Contains(query, "INSERT INTO audit_log"):
+	default:
+		return nil, errors.New("unexpected statement: " + query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// TestUpdateStockIfMatch sends two recounts based on the same read at once.
+// Only one may win; the other must learn that the stock changed under it.
+func TestUpdateStockIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &stockStore{stock: 3, version: 1}
+	db := sql.OpenDB(store)
+	defer db.Close()
+	api := &API{db: db}
+
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i, body := range []string{`{"stock": 5}`, `{"stock": 7}`} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/products/1/stock", strings.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Request.Header.Set("If-Match", `"1"`)
+			c.Params = gin.Params{{Key: "id", Value: "1"}}
+			api.updateStock(c)
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	ok, stale := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusPreconditionFailed:
+			stale++
+		}
+	}
+	if ok != 1 || stale != 1 {
+		t.Errorf("two recounts with one ETag answered %v, want one 200 and one 412", codes)
+	}
+}
@@ -0,0 +1,689 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+// createPromotionRequest defines a promotion. Which of PercentOff,
+// AmountOff and BuyQty/GetQty is needed depends on Kind; the others are
+// ignored. A promotion without a Code applies automatically.
+type createPromotionRequest struct {
+	Name             string               `json:"name" validate:"notblank,max=100"`
+	Code             string               `json:"code" validate:"omitempty,min=3,max=40,printascii"`
+	Kind             models.PromotionKind `json:"kind" validate:"required,oneof=percent_off amount_off buy_x_get_y"`
+	PercentOff       int                  `json:"percent_off" validate:"required_if=Kind percent_off,min=0,max=100"`
+	AmountOff        models.Money         `json:"amount_off" validate:"required_if=Kind amount_off,min=0"`
+	BuyQty           int                  `json:"buy_qty" validate:"required_if=Kind buy_x_get_y,min=0,max=100"`
+	GetQty           int                  `json:"get_qty" validate:"required_if=Kind buy_x_get_y,min=0,max=100"`
+	ProductID        *int64               `json:"product_id" validate:"omitnil,gt=0"`
+	CategoryID       *int64               `json:"category_id" validate:"omitnil,gt=0"`
+	MinSubtotal      models.Money         `json:"min_subtotal" validate:"min=0"`
+	StartsAt         *time.Time           `json:"starts_at"`
+	EndsAt           *time.Time           `json:"ends_at"`
+	UsageLimit       *int                 `json:"usage_limit" validate:"omitnil,gt=0"`
+	PerCustomerLimit *int                 `json:"per_customer_limit" validate:"omitnil,gt=0"`
+}
+
+// updatePromotionRequest changes how long and how often a promotion may be
+// used. What it takes off stays fixed once orders may carry it; end it and
+// create a new one instead. Sending null for starts_at or ends_at removes
+// that bound.
+type updatePromotionRequest struct {
+	Name             *string             `json:"name" validate:"omitnil,notblank,max=100"`
+	Active           *bool               `json:"active"`
+	StartsAt         nullable[time.Time] `json:"starts_at"`
+	EndsAt           nullable[time.Time] `json:"ends_at"`
+	UsageLimit       *int                `json:"usage_limit" validate:"omitnil,gt=0"`
+	PerCustomerLimit *int                `json:"per_customer_limit" validate:"omitnil,gt=0"`
+	Version          *int                `json:"version"`
+}
+
+// nullable is a request field that tells a missing value apart from an
+// explicit null: Set reports whether the field was in the body at all, and
+// Value is nil when it was null.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	n.Value = nil
+	if string(b) == "null" {
+		return nil
+	}
+	return json.Unmarshal(b, &n.Value)
+}
+
+// promotionSelect selects the columns read by scanPromotion.
+const promotionSelect = `
+	SELECT pr.id, pr.name, COALESCE(pr.code, ''), pr.kind, COALESCE(pr.percent_off, 0), COALESCE(pr.amount_off, 0),
+	       COALESCE(pr.buy_qty, 0), COALESCE(pr.get_qty, 0), pr.product_id, pr.category_id, pr.min_subtotal,
+	       pr.starts_at, pr.ends_at, pr.usage_limit, pr.per_customer_limit,
+	       (SELECT COUNT(*) FROM order_discounts d JOIN orders o ON o.id = d.order_id
+	        WHERE d.promotion_id = pr.id AND o.status <> 'cancelled'),
+	       pr.active, pr.version, pr.created_at
+	FROM promotions pr`
+
+func (a *API) listPromotions(c *gin.Context) {
+	query := promotionSelect
+	if c.Query("active") == "true" {
+		query += " WHERE pr.active AND (pr.ends_at IS NULL OR pr.ends_at > NOW())"
+	}
+	rows, err := a.db.Query(query + " ORDER BY pr.id")
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	promotions := make([]models.Promotion, 0)
+	for rows.Next() {
+		p, err := scanPromotion(rows.Scan)
+		if err != nil {
+			failErr(c, err)
+			return
+		}
+		promotions = append(promotions, p)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, promotions)
+}
+
+func (a *API) getPromotion(c *gin.Context) {
+	id, ok := parseID(c, "promotion")
+	if !ok {
+		return
+	}
+	p, err := loadPromotion(a.db, id, false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "promotion not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	setETag(c, p.Version)
+	c.JSON(http.StatusOK, p)
+}
+
+// getPromotionByCode looks up a coupon before it is used, answering 409
+// with the reason when it cannot be used right now, or by the customer
+// given as customer_id.
+func (a *API) getPromotionByCode(c *gin.Context) {
+	customerID, ok := queryInt(c, "customer_id")
+	if !ok {
+		return
+	}
+	p, err := scanPromotion(a.db.QueryRow(promotionSelect+" WHERE upper(pr.code) = upper($1)", strings.TrimSpace(c.Param("code"))).Scan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "no promotion has this code")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	var customer int64
+	if customerID != nil {
+		customer = *customerID
+	}
+	// Orders check promotions against the database clock, so do the same.
+	var now time.Time
+	if err := a.db.QueryRow("SELECT NOW()").Scan(&now); err != nil {
+		failErr(c, err)
+		return
+	}
+	problem, err := promotionProblem(a.db, p, customer, now)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if problem != "" {
+		fail(c, http.StatusConflict, codeConflict, "coupon "+problem)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (a *API) createPromotion(c *gin.Context) {
+	var req createPromotionRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.ProductID != nil && req.CategoryID != nil {
+		invalidField(c, "category_id", "must not be given together with product_id")
+		return
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		invalidField(c, "ends_at", "must be after starts_at")
+		return
+	}
+	p := models.Promotion{
+		Name:             req.Name,
+		Code:             strings.ToUpper(strings.TrimSpace(req.Code)),
+		Kind:             req.Kind,
+		ProductID:        req.ProductID,
+		CategoryID:       req.CategoryID,
+		MinSubtotal:      req.MinSubtotal,
+		StartsAt:         req.StartsAt,
+		EndsAt:           req.EndsAt,
+		UsageLimit:       req.UsageLimit,
+		PerCustomerLimit: req.PerCustomerLimit,
+		Active:           true,
+	}
+	switch p.Kind {
+	case models.PromotionPercentOff:
+		p.PercentOff = req.PercentOff
+	case models.PromotionAmountOff:
+		p.AmountOff = req.AmountOff
+	case models.PromotionBuyXGetY:
+		p.BuyQty, p.GetQty = req.BuyQty, req.GetQty
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if p.ProductID != nil {
+		if _, err := loadProduct(tx, *p.ProductID, false); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				invalidField(c, "product_id", "no such product")
+				return
+			}
+			failErr(c, err)
+			return
+		}
+	}
+	if p.CategoryID != nil {
+		if _, err := loadCategory(tx, *p.CategoryID, false); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				invalidField(c, "category_id", "no such category")
+				return
+			}
+			failErr(c, err)
+			return
+		}
+	}
+	err = tx.QueryRow(
+		`INSERT INTO promotions (name, code, kind, percent_off, amount_off, buy_qty, get_qty, product_id, category_id,
+		                         min_subtotal, starts_at, ends_at, usage_limit, per_customer_limit)
+		 VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, 0), NULLIF($5::numeric, 0), NULLIF($6, 0), NULLIF($7, 0), $8, $9, $10, $11, $12, $13, $14)
+		 RETURNING id, version, created_at`,
+		p.Name, p.Code, p.Kind, p.PercentOff, p.AmountOff, p.BuyQty, p.GetQty, p.ProductID, p.CategoryID,
+		p.MinSubtotal, p.StartsAt, p.EndsAt, p.UsageLimit, p.PerCustomerLimit,
+	).Scan(&p.ID, &p.Version, &p.CreatedAt)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "promotion", p.ID, nil, p); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusCreated, p)
+}
+
+func (a *API) updatePromotion(c *gin.Context) {
+	id, ok := parseID(c, "promotion")
+	if !ok {
+		return
+	}
+	var req updatePromotionRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.Name == nil && req.Active == nil && !req.StartsAt.Set && !req.EndsAt.Set && req.UsageLimit == nil && req.PerCustomerLimit == nil {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "nothing to update")
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, err := loadPromotion(tx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "promotion not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, p.Version, "promotion") {
+		return
+	}
+	before := p
+	if req.Name != nil {
+		p.Name = *req.Name
+	}
+	if req.Active != nil {
+		p.Active = *req.Active
+	}
+	if req.StartsAt.Set {
+		p.StartsAt = req.StartsAt.Value
+	}
+	if req.EndsAt.Set {
+		p.EndsAt = req.EndsAt.Value
+	}
+	if req.UsageLimit != nil {
+		p.UsageLimit = req.UsageLimit
+	}
+	if req.PerCustomerLimit != nil {
+		p.PerCustomerLimit = req.PerCustomerLimit
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		invalidField(c, "ends_at", "must be after starts_at")
+		return
+	}
+	err = tx.QueryRow(
+		"UPDATE promotions SET name=$1, active=$2, starts_at=$3, ends_at=$4, usage_limit=$5, per_customer_limit=$6 WHERE id=$7 RETURNING version",
+		p.Name, p.Active, p.StartsAt, p.EndsAt, p.UsageLimit, p.PerCustomerLimit, id,
+	).Scan(&p.Version)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "promotion", id, before, p); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusOK, p)
+}
+
+// applyPromotions works out the discount lines of a new order whose items
+// are already priced, records them and sets order.Discount. Every
+// automatic promotion the order qualifies for applies, in the order they
+// were created, followed by the coupon given as code. The discount never
+// exceeds the subtotal. Promotions the order uses that have a usage limit
+// stay locked until the order is committed so the limits hold under
+// concurrent orders; other promotions are not locked, so orders do not
+// queue behind each other. A coupon that cannot be used or takes nothing
+// off is reported as a *fieldError.
+func applyPromotions(tx *sql.Tx, order *models.Order, code string) error {
+	var now time.Time
+	if err := tx.QueryRow("SELECT NOW()").Scan(&now); err != nil {
+		return err
+	}
+	promotions, err := queryPromotions(tx, " WHERE pr.code IS NULL AND pr.active ORDER BY pr.id")
+	if err != nil {
+		return err
+	}
+	coupon := -1
+	if code = strings.TrimSpace(code); code != "" {
+		found, err := queryPromotions(tx, " WHERE upper(pr.code) = upper($1)", code)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return &fieldError{"coupon_code", "is not a valid code"}
+		}
+		coupon = len(promotions)
+		promotions = append(promotions, found[0])
+	}
+	if err := lockLimitedPromotions(tx, promotions, order, now); err != nil {
+		return err
+	}
+
+	remaining := order.Subtotal
+	for i, p := range promotions {
+		problem, err := promotionProblem(tx, p, order.CustomerID, now)
+		if err != nil {
+			return err
+		}
+		var amount models.Money
+		var scope map[int64]bool
+		if problem == "" {
+			if scope, err = promotionScope(tx, p); err != nil {
+				return err
+			}
+			amount = min(promotionDiscount(p, order.Items, order.Subtotal, scope), remaining)
+		}
+		if amount <= 0 {
+			if i == coupon {
+				if problem == "" {
+					problem = "does not apply to this order"
+				}
+				return &fieldError{"coupon_code", problem}
+			}
+			continue
+		}
+		d := models.OrderDiscount{OrderID: order.ID, PromotionID: p.ID, Code: p.Code, Description: p.Name, Amount: amount}
+		if err := tx.QueryRow(
+			"INSERT INTO order_discounts (order_id, promotion_id, code, description, amount) VALUES ($1, $2, NULLIF($3, ''), $4, $5) RETURNING id",
+			d.OrderID, d.PromotionID, d.Code, d.Description, d.Amount,
+		).Scan(&d.ID); err != nil {
+			return err
+		}
+		order.Discounts = append(order.Discounts, d)
+		order.Discount += amount
+		remaining -= amount
+		spreadDiscount(order.Items, amount, scope)
+	}
+	return nil
+}
+
+// spreadDiscount adds amount to the Discount of items, in proportion to
+// what is left of each line in the promotion's scope and, for any part the
+// scope cannot take after earlier discounts, of every line. No line is
+// discounted below zero as long as amount fits the order.
+func spreadDiscount(items []models.OrderItem, amount models.Money, scope map[int64]bool) {
+	for _, scoped := range []bool{true, false} {
+		left := make([]models.Money, len(items))
+		var room models.Money
+		for i, it := range items {
+			if scoped && scope != nil && !scope[it.ProductID] {
+				continue
+			}
+			left[i] = it.LineTotal - it.Discount
+			room += left[i]
+		}
+		part := min(amount, room)
+		for i, share := range part.Split(left) {
+			items[i].Discount += share
+		}
+		if amount -= part; amount == 0 {
+			return
+		}
+	}
+}
+
+// lockLimitedPromotions locks those of promotions that apply to order and
+// have a usage limit, in id order so concurrent orders wait for each other
+// instead of deadlocking, and then reloads them so their use counts
+// include orders committed while waiting.
+func lockLimitedPromotions(tx *sql.Tx, promotions []models.Promotion, order *models.Order, now time.Time) error {
+	var ids []int64
+	for _, p := range promotions {
+		if p.UsageLimit == nil && p.PerCustomerLimit == nil {
+			continue
+		}
+		problem, err := promotionProblem(tx, p, order.CustomerID, now)
+		if err != nil {
+			return err
+		}
+		if problem != "" {
+			continue
+		}
+		scope, err := promotionScope(tx, p)
+		if err != nil {
+			return err
+		}
+		if promotionDiscount(p, order.Items, order.Subtotal, scope) > 0 {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if _, err := tx.Exec("SELECT id FROM promotions WHERE id = ANY($1::int[]) ORDER BY id FOR UPDATE", ids); err != nil {
+		return err
+	}
+	locked, err := queryPromotions(tx, " WHERE pr.id = ANY($1::int[])", ids)
+	if err != nil {
+		return err
+	}
+	for _, l := range locked {
+		for i := range promotions {
+			if promotions[i].ID == l.ID {
+				promotions[i] = l
+			}
+		}
+	}
+	return nil
+}
+
+func queryPromotions(q queryer, where string, args ...any) ([]models.Promotion, error) {
+	rows, err := q.Query(promotionSelect+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var promotions []models.Promotion
+	for rows.Next() {
+		p, err := scanPromotion(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, p)
+	}
+	return promotions, rows.Err()
+}
+
+// promotionProblem says why p cannot be used at time now by the customer
+// (0 for no one in particular), such as "has expired", or returns "" when
+// it can.
+func promotionProblem(q rowQueryer, p models.Promotion, customerID int64, now time.Time) (string, error) {
+	switch {
+	case !p.Active:
+		return "is no longer active", nil
+	case p.StartsAt != nil && p.StartsAt.After(now):
+		return "is not valid until " + p.StartsAt.Format(time.DateOnly), nil
+	case p.EndsAt != nil && !p.EndsAt.After(now):
+		return "has expired", nil
+	case p.UsageLimit != nil && p.Uses >= *p.UsageLimit:
+		return "has been used up", nil
+	}
+	if p.PerCustomerLimit != nil && customerID != 0 {
+		var uses int
+		err := q.QueryRow(
+			`SELECT COUNT(*) FROM order_discounts d JOIN orders o ON o.id = d.order_id
+			 WHERE d.promotion_id=$1 AND o.customer_id=$2 AND o.status <> 'cancelled'`,
+			p.ID, customerID,
+		).Scan(&uses)
+		if err != nil {
+			return "", err
+		}
+		if uses >= *p.PerCustomerLimit {
+			return "has already been used by this customer", nil
+		}
+	}
+	return "", nil
+}
+
+// perCustomerLimitReached returns the name of a promotion applied to the
+// order that the customer has already used as often as its
+// per_customer_limit allows, or "" when moving the order to the customer
+// keeps within every limit. The promotions are locked as createOrder locks
+// them, so a new order cannot use them up at the same time.
+func perCustomerLimitReached(tx *sql.Tx, orderID, customerID int64) (string, error) {
+	rows, err := tx.Query(
+		`SELECT pr.id, pr.name, pr.per_customer_limit FROM promotions pr
+		 WHERE pr.per_customer_limit IS NOT NULL
+		   AND pr.id IN (SELECT promotion_id FROM order_discounts WHERE order_id=$1)
+		 ORDER BY pr.id FOR UPDATE`,
+		orderID,
+	)
+	if err != nil {
+		return "", err
+	}
+	type limited struct {
+		id    int64
+		name  string
+		limit int
+	}
+	var promotions []limited
+	for rows.Next() {
+		var p limited
+		if err := rows.Scan(&p.id, &p.name, &p.limit); err != nil {
+			rows.Close()
+			return "", err
+		}
+		promotions = append(promotions, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	for _, p := range promotions {
+		var uses int
+		err := tx.QueryRow(
+			`SELECT COUNT(*) FROM order_discounts d JOIN orders o ON o.id = d.order_id
+			 WHERE d.promotion_id=$1 AND o.customer_id=$2 AND o.id<>$3 AND o.status <> 'cancelled'`,
+			p.id, customerID, orderID,
+		).Scan(&uses)
+		if err != nil {
+			return "", err
+		}
+		if uses >= p.limit {
+			return p.name, nil
+		}
+	}
+	return "", nil
+}
+
+// promotionScope returns the products a promotion is limited to, or nil
+// when it covers the whole order. A category includes the products of
+// every category below it.
+func promotionScope(q queryer, p models.Promotion) (map[int64]bool, error) {
+	switch {
+	case p.ProductID != nil:
+		return map[int64]bool{*p.ProductID: true}, nil
+	case p.CategoryID == nil:
+		return nil, nil
+	}
+	rows, err := q.Query("SELECT product_id FROM product_categories WHERE category_id IN ("+categorySubtree("$1")+")", *p.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	scope := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		scope[id] = true
+	}
+	return scope, rows.Err()
+}
+
+// promotionDiscount is what p takes off items in scope (every item when
+// scope is nil), or 0 when the order's subtotal is below its minimum.
+func promotionDiscount(p models.Promotion, items []models.OrderItem, subtotal models.Money, scope map[int64]bool) models.Money {
+	if subtotal < p.MinSubtotal {
+		return 0
+	}
+	var base models.Money
+	var units []models.Money
+	for _, it := range items {
+		if scope != nil && !scope[it.ProductID] {
+			continue
+		}
+		base += it.LineTotal
+		if p.Kind == models.PromotionBuyXGetY {
+			for range it.Qty {
+				units = append(units, it.PriceEach)
+			}
+		}
+	}
+	switch p.Kind {
+	case models.PromotionPercentOff:
+		return base.ApplyRate(int64(p.PercentOff) * 100)
+	case models.PromotionAmountOff:
+		return min(p.AmountOff, base)
+	case models.PromotionBuyXGetY:
+		// The cheapest units in scope are the free ones.
+		sort.Slice(units, func(i, j int) bool { return units[i] < units[j] })
+		free := len(units) / (p.BuyQty + p.GetQty) * p.GetQty
+		var amount models.Money
+		for _, price := range units[:free] {
+			amount += price
+		}
+		return amount
+	}
+	return 0
+}
+
+// attachOrderDiscounts fills in the discount lines of all given orders
+// with a single query.
+func attachOrderDiscounts(q queryer, orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*models.Order, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		orders[i].Discounts = make([]models.OrderDiscount, 0)
+		byID[orders[i].ID] = &orders[i]
+	}
+
+	rows, err := q.Query(
+		"SELECT id, order_id, promotion_id, COALESCE(code, ''), description, amount FROM order_discounts WHERE order_id = ANY($1) ORDER BY order_id, id",
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.OrderDiscount
+		if err := rows.Scan(&d.ID, &d.OrderID, &d.PromotionID, &d.Code, &d.Description, &d.Amount); err != nil {
+			return err
+		}
+		o := byID[d.OrderID]
+		o.Discounts = append(o.Discounts, d)
+	}
+	return rows.Err()
+}
+
+// loadPromotion fetches one promotion, locking its row when forUpdate is
+// set.
+func loadPromotion(q rowQueryer, id int64, forUpdate bool) (models.Promotion, error) {
+	query := promotionSelect + " WHERE pr.id=$1"
+	if forUpdate {
+		query += " FOR UPDATE OF pr"
+	}
+	return scanPromotion(q.QueryRow(query, id).Scan)
+}
+
+func scanPromotion(scan func(dest ...any) error) (models.Promotion, error) {
+	var p models.Promotion
+	err := scan(
+		&p.ID, &p.Name, &p.Code, &p.Kind, &p.PercentOff, &p.AmountOff,
+		&p.BuyQty, &p.GetQty, &p.ProductID, &p.CategoryID, &p.MinSubtotal,
+		&p.StartsAt, &p.EndsAt, &p.UsageLimit, &p.PerCustomerLimit,
+		&p.Uses, &p.Active, &p.Version, &p.CreatedAt,
+	)
+	return p, err
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"terminal_store/pkg/models"
+)
+
+func TestPromotionDiscount(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: 1, Qty: 2, PriceEach: 1000, LineTotal: 2000},
+		{ProductID: 2, Qty: 1, PriceEach: 800, LineTotal: 800},
+		{ProductID: 3, Qty: 3, PriceEach: 500, LineTotal: 1500},
+	}
+	const subtotal = models.Money(4300)
+	tests := []struct {
+		name  string
+		p     models.Promotion
+		scope map[int64]bool
+		want  models.Money
+	}{
+		{"percent of order", models.Promotion{Kind: models.PromotionPercentOff, PercentOff: 10}, nil, 430},
+		{"percent of product", models.Promotion{Kind: models.PromotionPercentOff, PercentOff: 10}, map[int64]bool{3: true}, 150},
+		{"percent rounds half up", models.Promotion{Kind: models.PromotionPercentOff, PercentOff: 15}, map[int64]bool{2: true, 3: true}, 345},
+		{"amount off", models.Promotion{Kind: models.PromotionAmountOff, AmountOff: 500}, nil, 500},
+		{"amount off capped by scope", models.Promotion{Kind: models.PromotionAmountOff, AmountOff: 1000}, map[int64]bool{2: true}, 800},
+		{"below min subtotal", models.Promotion{Kind: models.PromotionAmountOff, AmountOff: 500, MinSubtotal: 5000}, nil, 0},
+		{"at min subtotal", models.Promotion{Kind: models.PromotionAmountOff, AmountOff: 500, MinSubtotal: 4300}, nil, 500},
+		{"buy 2 get 1 takes the cheapest", models.Promotion{Kind: models.PromotionBuyXGetY, BuyQty: 2, GetQty: 1}, map[int64]bool{1: true, 2: true}, 800},
+		{"buy 2 get 1 twice", models.Promotion{Kind: models.PromotionBuyXGetY, BuyQty: 2, GetQty: 1}, nil, 1000},
+		{"buy 3 get 1 too few units", models.Promotion{Kind: models.PromotionBuyXGetY, BuyQty: 3, GetQty: 1}, map[int64]bool{3: true}, 0},
+		{"nothing in scope", models.Promotion{Kind: models.PromotionPercentOff, PercentOff: 50}, map[int64]bool{9: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promotionDiscount(tt.p, items, subtotal, tt.scope); got != tt.want {
+				t.Errorf("promotionDiscount = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpreadDiscount(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: 1, LineTotal: 1000},
+		{ProductID: 2, LineTotal: 333},
+		{ProductID: 3, LineTotal: 1},
+	}
+	// More than products 2 and 3 are worth: the rest comes off product 1.
+	spreadDiscount(items, 500, map[int64]bool{2: true, 3: true})
+	want := []models.Money{166, 333, 1}
+	for i, it := range items {
+		if it.Discount != want[i] {
+			t.Errorf("after scoped discount, item %d discount = %s, want %s", i, it.Discount, want[i])
+		}
+	}
+	// Only product 1 has anything left to discount.
+	spreadDiscount(items, 101, nil)
+	want = []models.Money{267, 333, 1}
+	for i, it := range items {
+		if it.Discount != want[i] {
+			t.Errorf("after order discount, item %d discount = %s, want %s", i, it.Discount, want[i])
+		}
+	}
+}
+
+func TestUpdatePromotionRequestDates(t *testing.T) {
+	tests := []struct {
+		body     string
+		set      bool
+		hasValue bool
+	}{
+		{`{}`, false, false},
+		{`{"ends_at": null}`, true, false},
+		{`{"ends_at": "2026-12-31T23:59:59Z"}`, true, true},
+	}
+	for _, tt := range tests {
+		var req updatePromotionRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Errorf("decoding %s: %v", tt.body, err)
+			continue
+		}
+		if req.EndsAt.Set != tt.set || (req.EndsAt.Value != nil) != tt.hasValue {
+			t.Errorf("decoding %s: ends_at = %+v", tt.body, req.EndsAt)
+		}
+		if req.StartsAt.Set {
+			t.Errorf("decoding %s: starts_at is set", tt.body)
+		}
+	}
+	var req updatePromotionRequest
+	if err := json.Unmarshal([]byte(`{"ends_at": "soon"}`), &req); err == nil {
+		t.Error("decoding an ends_at that is not a time succeeded")
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+func (a *API) createReturn(c *gin.Context) {
+	orderID, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+	var req models.NewReturn
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the order serialises returns against each other and against
+	// cancellation, so the remaining quantities read below stay accurate.
+	var status models.OrderStatus
+	if err := tx.QueryRow("SELECT status FROM orders WHERE id=$1 FOR UPDATE", orderID).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !status.Returnable() {
+		fail(c, http.StatusConflict, codeConflict, "cannot return items from a "+string(status)+" order")
+		return
+	}
+
+	ret := models.Return{OrderID: orderID, Restocked: req.Restock, Reason: req.Reason}
+	if err := tx.QueryRow(
+		"INSERT INTO returns (order_id, restocked, reason) VALUES ($1, $2, $3) RETURNING id, created_at",
+		orderID, req.Restock, req.Reason,
+	).Scan(&ret.ID, &ret.CreatedAt); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	ret.Items = make([]models.ReturnItem, 0, len(req.Items))
+	restock := make([]models.InventoryMovement, 0, len(req.Items))
+	for _, it := range req.Items {
+		var bought, returned int
+		var variantID int64
+		var paid models.Money
+		item := models.ReturnItem{ReturnID: ret.ID, OrderItemID: it.OrderItemID, Qty: it.Qty}
+		err := tx.QueryRow(`
+			SELECT oi.product_id, oi.variant_id, oi.qty, oi.line_total - oi.discount + oi.tax,
+			       COALESCE((SELECT SUM(ri.qty) FROM return_items ri WHERE ri.order_item_id = oi.id), 0)
+			FROM order_items oi WHERE oi.id=$1 AND oi.order_id=$2`,
+			it.OrderItemID, orderID,
+		).Scan(&item.ProductID, &variantID, &bought, &paid, &returned)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				fail(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("order item %d is not part of this order", it.OrderItemID))
+				return
+			}
+			failErr(c, err)
+			return
+		}
+		if remaining := bought - returned; it.Qty > remaining {
+			fail(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("order item %d has only %d left to return", it.OrderItemID, remaining))
+			return
+		}
+		item.RefundEach = refundShare(paid, 1, bought)
+		item.Refund = refundShare(paid, returned+it.Qty, bought) - refundShare(paid, returned, bought)
+
+		if err := tx.QueryRow(
+			"INSERT INTO return_items (return_id, order_item_id, qty, refund_each, refund) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			ret.ID, it.OrderItemID, it.Qty, item.RefundEach, item.Refund,
+		).Scan(&item.ID); err != nil {
+			failErr(c, err)
+			return
+		}
+		if req.Restock {
+			restock = append(restock, models.InventoryMovement{
+				ProductID: item.ProductID,
+				VariantID: &variantID,
+				Delta:     it.Qty,
+				Reason:    models.MovementReturn,
+				Note:      "return #" + strconv.FormatInt(ret.ID, 10),
+				OrderID:   &orderID,
+			})
+		}
+		ret.RefundAmount += item.Refund
+		ret.Items = append(ret.Items, item)
+	}
+	// Restock in product and variant order, as createOrder and
+	// restockOrder lock them, so a return cannot deadlock with an order.
+	slices.SortFunc(restock, func(a, b models.InventoryMovement) int {
+		return cmp.Or(cmp.Compare(a.ProductID, b.ProductID), cmp.Compare(*a.VariantID, *b.VariantID))
+	})
+	for i := range restock {
+		if err := applyMovement(tx, c, &restock[i]); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE returns SET refund_amount=$1 WHERE id=$2", ret.RefundAmount, ret.ID); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "return", ret.ID, nil, ret); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ret)
+}
+
+// refundShare is the part of paid, the amount paid for a line of qty
+// units, that the first units of them account for, rounded half away from
+// zero. Refunding returned units as the difference of two shares pays back
+// exactly paid once every unit has come back, however they are split.
+func refundShare(paid models.Money, units, qty int) models.Money {
+	if qty == 0 {
+		return 0
+	}
+	v := int64(paid) * int64(units)
+	return models.Money((v + int64(qty)/2) / int64(qty))
+}
+
+func (a *API) listReturns(c *gin.Context) {
+	orderID, ok := parseID(c, "order")
+	if !ok {
+		return
+	}
+
+	var exists bool
+	if err := a.db.QueryRow("SELECT true FROM orders WHERE id=$1", orderID).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+
+	rows, err := a.db.Query(`
+		SELECT r.id, r.order_id, r.restocked, r.refund_amount, r.reason, r.created_at,
+		       ri.id, ri.order_item_id, oi.product_id, ri.qty, ri.refund_each, ri.refund
+		FROM returns r
+		JOIN return_items ri ON ri.return_id = r.id
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		WHERE r.order_id=$1
+		ORDER BY r.id, ri.id`,
+		orderID,
+	)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	returns := make([]models.Return, 0)
+	for rows.Next() {
+		var r models.Return
+		var it models.ReturnItem
+		if err := rows.Scan(
+			&r.ID, &r.OrderID, &r.Restocked, &r.RefundAmount, &r.Reason, &r.CreatedAt,
+			&it.ID, &it.OrderItemID, &it.ProductID, &it.Qty, &it.RefundEach, &it.Refund,
+		); err != nil {
+			failErr(c, err)
+			return
+		}
+		it.ReturnID = r.ID
+		if n := len(returns); n == 0 || returns[n-1].ID != r.ID {
+			r.Items = make([]models.ReturnItem, 0, 1)
+			returns = append(returns, r)
+		}
+		last := &returns[len(returns)-1]
+		last.Items = append(last.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, returns)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"terminal_store/pkg/models"
+)
+
+func TestRefundShare(t *testing.T) {
+	if got := refundShare(1000, 1, 3); got != 333 {
+		t.Errorf("refundShare(10.00, 1, 3) = %s, want 3.33", got)
+	}
+	if got := refundShare(1001, 1, 2); got != 501 {
+		t.Errorf("refundShare(10.01, 1, 2) = %s, want 5.01", got)
+	}
+	// However the units come back, the refunds add up to what was paid.
+	for _, batches := range [][]int{{1, 1, 1}, {2, 1}, {1, 2}, {3}} {
+		const paid = models.Money(1000)
+		var refunded models.Money
+		returned := 0
+		for _, n := range batches {
+			refunded += refundShare(paid, returned+n, 3) - refundShare(paid, returned, 3)
+			returned += n
+		}
+		if refunded != paid {
+			t.Errorf("returning %v refunds %s, want %s", batches, refunded, paid)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"terminal_store/pkg/models"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so that the response takes as long as for a wrong password.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// sessionTokens is returned by login and refresh. The access token goes in
+// the Authorization header; the refresh token buys a new pair once it
+// expires.
+type sessionTokens struct {
+	AccessToken      string      `json:"access_token"`
+	AccessExpiresAt  time.Time   `json:"access_expires_at"`
+	RefreshToken     string      `json:"refresh_token"`
+	RefreshExpiresAt time.Time   `json:"refresh_expires_at"`
+	User             models.User `json:"user"`
+}
+
+var userSorts = map[string]sortField{
+	"id":       {"id", "int"},
+	"username": {"username", "text"},
+}
+
+func (a *API) login(c *gin.Context) {
+	var req loginRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	var u models.User
+	var hash []byte
+	err := a.db.QueryRow(
+		"SELECT id, username, role, created_at, password_hash FROM users WHERE username=$1 AND disabled_at IS NULL",
+		strings.TrimSpace(req.Username),
+	).Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt, &hash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		failErr(c, err)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || errors.Is(err, sql.ErrNoRows) {
+		fail(c, http.StatusUnauthorized, codeUnauthorized, "wrong username or password")
+		return
+	}
+
+	tokens, err := startSession(a.db, u)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// refreshSession trades a refresh token for a new session. The old session
+// is revoked, so a refresh token can only be used once.
+func (a *API) refreshSession(c *gin.Context) {
+	var req refreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		invalidField(c, "refresh_token", "is required")
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var sessionID int64
+	var u models.User
+	err = tx.QueryRow(
+		`SELECT s.id, u.id, u.username, u.role, u.created_at FROM sessions s JOIN users u ON u.id = s.user_id
+		 WHERE s.refresh_hash=$1 AND s.revoked_at IS NULL AND s.refresh_expires_at > NOW() AND u.disabled_at IS NULL
+		 FOR UPDATE OF s`,
+		hashToken(req.RefreshToken),
+	).Scan(&sessionID, &u.ID, &u.Username, &u.Role, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		fail(c, http.StatusUnauthorized, codeUnauthorized, "invalid or expired refresh token")
+		return
+	}
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE sessions SET revoked_at = NOW() WHERE id=$1", sessionID); err != nil {
+		failErr(c, err)
+		return
+	}
+	tokens, err := startSession(tx, u)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (a *API) logout(c *gin.Context) {
+	sessionID := c.GetInt64(ctxSessionID)
+	if sessionID == 0 {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "API keys cannot log out; revoke the key instead")
+		return
+	}
+	if _, err := a.db.Exec("UPDATE sessions SET revoked_at = NOW() WHERE id=$1", sessionID); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// changePassword sets a new password for the logged-in user and ends all of
+// their other sessions.
+func (a *API) changePassword(c *gin.Context) {
+	userID := c.GetInt64(ctxUserID)
+	if userID == 0 {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "log in as a user to change a password")
+		return
+	}
+	var req models.PasswordChange
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var hash []byte
+	if err := tx.QueryRow("SELECT password_hash FROM users WHERE id=$1 FOR UPDATE", userID).Scan(&hash); err != nil {
+		failErr(c, err)
+		return
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.CurrentPassword)) != nil {
+		fail(c, http.StatusForbidden, codeForbidden, "current password is wrong")
+		return
+	}
+	newHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET password_hash=$1 WHERE id=$2", newHash, userID); err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec(
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id=$1 AND id<>$2 AND revoked_at IS NULL",
+		userID, c.GetInt64(ctxSessionID),
+	); err != nil {
+		failErr(c, err)
+		return
+	}
+	// Snapshots are left out: the only change is the password hash.
+	if err := recordAudit(tx, c, auditPassword, "user", userID, nil, nil); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (a *API) listUsers(c *gin.Context) {
+	pg, ok := parsePage(c, userSorts, "username")
+	if !ok {
+		return
+	}
+	var q listQuery
+	if c.Query("include_disabled") != "true" {
+		q.filter("disabled_at IS NULL")
+	}
+
+	query := "SELECT id, username, role, created_at, disabled_at, " + pg.sort.column + "::text FROM users" + q.build(pg, "id")
+	rows, err := a.db.Query(query, q.args...)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	keys := make([]pageCursor, 0)
+	for rows.Next() {
+		var u models.User
+		var key pageCursor
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt, &u.DisabledAt, &key.Value); err != nil {
+			failErr(c, err)
+			return
+		}
+		key.ID = u.ID
+		users = append(users, u)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, finishPage(pg, users, keys))
+}
+
+func (a *API) createUser(c *gin.Context) {
+	var req models.NewUser
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	u := models.User{Username: req.Username, Role: req.Role}
+	err = tx.QueryRow(
+		"INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3) ON CONFLICT (username) DO NOTHING RETURNING id, created_at",
+		u.Username, hash, u.Role,
+	).Scan(&u.ID, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		fail(c, http.StatusConflict, codeAlreadyExists, "username is taken")
+		return
+	}
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "user", u.ID, nil, u); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, u)
+}
+
+// disableUser blocks a user from logging in and ends their sessions. The
+// row is kept so the user's past actions stay attributable.
+func (a *API) disableUser(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+	if id == c.GetInt64(ctxUserID) {
+		fail(c, http.StatusConflict, codeConflict, "cannot disable yourself")
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadUser(tx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "user not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id=$1", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE sessions SET revoked_at = NOW() WHERE user_id=$1 AND revoked_at IS NULL", id); err != nil {
+		failErr(c, err)
+		return
+	}
+	after, err := loadUser(tx, id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditDisable, "user", id, before, after); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// startSession issues a fresh access and refresh token for u.
+func startSession(q rowQueryer, u models.User) (sessionTokens, error) {
+	t := sessionTokens{User: u}
+	var err error
+	if t.AccessToken, err = newToken("tsa_"); err != nil {
+		return t, err
+	}
+	if t.RefreshToken, err = newToken("tsr_"); err != nil {
+		return t, err
+	}
+	// Expiry is computed by the database, whose clock NOW() checks it against.
+	var id int64
+	err = q.QueryRow(
+		`INSERT INTO sessions (user_id, access_hash, refresh_hash, access_expires_at, refresh_expires_at)
+		 VALUES ($1, $2, $3, NOW() + make_interval(secs => $4), NOW() + make_interval(secs => $5))
+		 RETURNING id, access_expires_at, refresh_expires_at`,
+		u.ID, hashToken(t.AccessToken), hashToken(t.RefreshToken), accessTokenTTL.Seconds(), refreshTokenTTL.Seconds(),
+	).Scan(&id, &t.AccessExpiresAt, &t.RefreshExpiresAt)
+	return t, err
+}
+
+func loadUser(q rowQueryer, id int64) (models.User, error) {
+	var u models.User
+	err := q.QueryRow("SELECT id, username, role, created_at, disabled_at FROM users WHERE id=$1", id).
+		Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt, &u.DisabledAt)
+	return u, err
+}
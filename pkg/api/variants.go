@@ -0,0 +1,647 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"terminal_store/pkg/models"
+)
+
+type createOptionRequest struct {
+	Name   string   `json:"name" validate:"notblank,max=50"`
+	Values []string `json:"values" validate:"max=50,unique,dive,notblank,max=50"`
+}
+
+type addOptionValueRequest struct {
+	Value string `json:"value" validate:"notblank,max=50"`
+}
+
+// createVariantRequest names the variant by one value of each option, e.g.
+// {"Color": "Red", "Size": "L"}. Price is left out to sell at the
+// product's price.
+type createVariantRequest struct {
+	SKU     string            `json:"sku" validate:"omitempty,max=40,printascii"`
+	Price   *models.Money     `json:"price" validate:"omitnil,min=0"`
+	Stock   int               `json:"stock" validate:"min=0"`
+	Options map[string]string `json:"options" validate:"required,min=1,max=10"`
+}
+
+// updateVariantRequest changes a variant. InheritPrice drops its price
+// override; Options replaces its option values, which also turns a
+// product's plain variant into one of its options.
+type updateVariantRequest struct {
+	SKU          *string           `json:"sku" validate:"omitnil,max=40,printascii"`
+	Price        *models.Money     `json:"price" validate:"omitnil,min=0"`
+	InheritPrice bool              `json:"inherit_price"`
+	Options      map[string]string `json:"options" validate:"omitnil,min=1,max=10"`
+	Version      *int              `json:"version"`
+}
+
+// variantSelect selects the columns read by scanVariant. Options are
+// gathered into a JSON object of option name to value.
+const variantSelect = `
+	SELECT v.id, v.product_id, COALESCE(v.sku, ''), v.price, COALESCE(v.price, ` + productPrice + `), v.stock, v.version, v.created_at,
+	       COALESCE((SELECT json_object_agg(o.name, ov.value ORDER BY o.id)
+	                 FROM variant_option_values vov
+	                 JOIN product_option_values ov ON ov.id = vov.option_value_id
+	                 JOIN product_options o ON o.id = ov.option_id
+	                 WHERE vov.variant_id = v.id), '{}')
+	FROM product_variants v JOIN products ON products.id = v.product_id`
+
+func (a *API) listProductOptions(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	if _, err := loadProduct(a.db, id, false); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	options, err := productOptions(a.db, id, 0)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+func (a *API) createProductOption(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	var req createOptionRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := loadProduct(tx, id, true); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	// Variants already named by their options would be left without a
+	// value for the new one.
+	var optioned bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id=$1 AND option_key<>'')", id).Scan(&optioned); err != nil {
+		failErr(c, err)
+		return
+	}
+	if optioned {
+		fail(c, http.StatusConflict, codeConflict, "the product already has variants with options; add every option before creating them")
+		return
+	}
+	var optionID int64
+	if err := tx.QueryRow("INSERT INTO product_options (product_id, name) VALUES ($1, $2) RETURNING id", id, req.Name).Scan(&optionID); err != nil {
+		failErr(c, err)
+		return
+	}
+	for _, value := range req.Values {
+		if _, err := tx.Exec("INSERT INTO product_option_values (option_id, value) VALUES ($1, $2)", optionID, value); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	options, err := productOptions(tx, id, optionID)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "product_option", optionID, nil, options[0]); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, options[0])
+}
+
+// addOptionValue adds one more value, such as a new color, to an option.
+func (a *API) addOptionValue(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	optionID, ok := parseIDParam(c, "option_id", "option")
+	if !ok {
+		return
+	}
+	var req addOptionValueRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT 1 FROM product_options WHERE id=$1 FOR UPDATE", optionID); err != nil {
+		failErr(c, err)
+		return
+	}
+	before, err := productOptions(tx, id, optionID)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if len(before) == 0 {
+		fail(c, http.StatusNotFound, codeNotFound, "option not found")
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO product_option_values (option_id, value) VALUES ($1, $2)", optionID, req.Value); err != nil {
+		failErr(c, err)
+		return
+	}
+	after, err := productOptions(tx, id, optionID)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "product_option", optionID, before[0], after[0]); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, after[0])
+}
+
+func (a *API) listVariants(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	if _, err := loadProduct(a.db, id, false); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	rows, err := a.db.Query(variantSelect+" WHERE v.product_id=$1 ORDER BY v.id", id)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer rows.Close()
+
+	variants := make([]models.Variant, 0)
+	for rows.Next() {
+		v, err := scanVariant(rows.Scan)
+		if err != nil {
+			failErr(c, err)
+			return
+		}
+		variants = append(variants, v)
+	}
+	if err := rows.Err(); err != nil {
+		failErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, variants)
+}
+
+func (a *API) createVariant(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	var req createVariantRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := loadProduct(tx, id, true); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	valueIDs, key, ok := variantOptions(c, tx, id, 0, req.Options)
+	if !ok {
+		return
+	}
+	if skuTaken(c, tx, req.SKU, 0, 0) {
+		return
+	}
+	var variantID int64
+	err = tx.QueryRow(
+		"INSERT INTO product_variants (product_id, sku, price, option_key) VALUES ($1, NULLIF($2, ''), $3, $4) RETURNING id",
+		id, req.SKU, req.Price, key,
+	).Scan(&variantID)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO variant_option_values (variant_id, option_value_id) SELECT $1, unnest($2::int[])", variantID, valueIDs); err != nil {
+		failErr(c, err)
+		return
+	}
+	if req.Stock > 0 {
+		m := models.InventoryMovement{ProductID: id, VariantID: &variantID, Delta: req.Stock, Reason: models.MovementRestock, Note: "initial stock", Opening: true}
+		if err := applyMovement(tx, c, &m); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	v, err := loadVariant(tx, id, variantID, false)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditCreate, "variant", v.ID, nil, v); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, v.Version)
+	c.JSON(http.StatusCreated, v)
+}
+
+func (a *API) updateVariant(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	variantID, ok := parseIDParam(c, "variant_id", "variant")
+	if !ok {
+		return
+	}
+	var req updateVariantRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.SKU == nil && req.Price == nil && !req.InheritPrice && req.Options == nil {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "nothing to update")
+		return
+	}
+	if req.InheritPrice && req.Price != nil {
+		invalidField(c, "price", "must not be given together with inherit_price")
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	v, err := loadVariant(tx, id, variantID, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "variant not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, v.Version, "variant") {
+		return
+	}
+	before := v
+	if req.SKU != nil {
+		if skuTaken(c, tx, *req.SKU, 0, variantID) {
+			return
+		}
+		v.SKU = *req.SKU
+	}
+	if req.Price != nil {
+		v.Price = req.Price
+	}
+	if req.InheritPrice {
+		v.Price = nil
+	}
+	if _, err := tx.Exec("UPDATE product_variants SET sku=NULLIF($1, ''), price=$2 WHERE id=$3", v.SKU, v.Price, variantID); err != nil {
+		failErr(c, err)
+		return
+	}
+	if req.Options != nil {
+		valueIDs, key, ok := variantOptions(c, tx, id, variantID, req.Options)
+		if !ok {
+			return
+		}
+		if _, err := tx.Exec("UPDATE product_variants SET option_key=$1 WHERE id=$2", key, variantID); err != nil {
+			failErr(c, err)
+			return
+		}
+		if _, err := tx.Exec("DELETE FROM variant_option_values WHERE variant_id=$1", variantID); err != nil {
+			failErr(c, err)
+			return
+		}
+		if _, err := tx.Exec("INSERT INTO variant_option_values (variant_id, option_value_id) SELECT $1, unnest($2::int[])", variantID, valueIDs); err != nil {
+			failErr(c, err)
+			return
+		}
+	}
+	if v, err = loadVariant(tx, id, variantID, false); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditUpdate, "variant", variantID, before, v); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	setETag(c, v.Version)
+	c.JSON(http.StatusOK, v)
+}
+
+// deleteVariant removes a variant that was set up by mistake or is no
+// longer made. Its stock must be adjusted to zero first, a product keeps
+// at least one variant, and variants that were sold stay for the order
+// history.
+func (a *API) deleteVariant(c *gin.Context) {
+	id, ok := parseID(c, "product")
+	if !ok {
+		return
+	}
+	variantID, ok := parseIDParam(c, "variant_id", "variant")
+	if !ok {
+		return
+	}
+	version, ok := expectedDeleteVersion(c)
+	if !ok {
+		return
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := loadProduct(tx, id, true); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "product not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	v, err := loadVariant(tx, id, variantID, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(c, http.StatusNotFound, codeNotFound, "variant not found")
+			return
+		}
+		failErr(c, err)
+		return
+	}
+	if !versionMatches(c, version, v.Version, "variant") {
+		return
+	}
+	if v.Stock != 0 {
+		fail(c, http.StatusConflict, codeConflict, fmt.Sprintf("variant still has %d in stock; adjust it to 0 first", v.Stock))
+		return
+	}
+	var others, sold bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id=$1 AND id<>$2), EXISTS (SELECT 1 FROM order_items WHERE variant_id=$2)",
+		id, variantID,
+	).Scan(&others, &sold)
+	if err != nil {
+		failErr(c, err)
+		return
+	}
+	if !others {
+		fail(c, http.StatusConflict, codeConflict, "a product keeps at least one variant")
+		return
+	}
+	if sold {
+		fail(c, http.StatusConflict, codeConflict, "variant has order history")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM product_variants WHERE id=$1", variantID); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := recordAudit(tx, c, auditDelete, "variant", variantID, v, nil); err != nil {
+		failErr(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		failErr(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// variantOptions resolves a variant's options to option value ids and the
+// option key stored with the variant, answering the request itself when
+// they name an unknown option or value or repeat another variant of the
+// product. exceptID is the variant being changed, or 0.
+func variantOptions(c *gin.Context, tx *sql.Tx, productID, exceptID int64, options map[string]string) ([]int64, string, bool) {
+	valueIDs, key, err := optionValueIDs(tx, productID, options)
+	if err != nil {
+		failErr(c, err)
+		return nil, "", false
+	}
+	var taken bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id=$1 AND option_key=$2 AND id<>$3)",
+		productID, key, exceptID,
+	).Scan(&taken)
+	if err != nil {
+		failErr(c, err)
+		return nil, "", false
+	}
+	if taken {
+		fail(c, http.StatusConflict, codeAlreadyExists, "the product already has a variant with these options")
+		return nil, "", false
+	}
+	return valueIDs, key, true
+}
+
+// optionValueIDs looks up the value ids for options, matching option names
+// and values without regard to case, and returns them sorted together with
+// their option key such as "3,7". options must give a value for every
+// option of the product.
+func optionValueIDs(q rowQueryer, productID int64, options map[string]string) ([]int64, string, error) {
+	seen := make(map[int64]bool, len(options))
+	ids := make([]int64, 0, len(options))
+	for name, value := range options {
+		field := "options." + name
+		var optionID int64
+		var valueID sql.NullInt64
+		err := q.QueryRow(
+			`SELECT o.id, v.id FROM product_options o
+			 LEFT JOIN product_option_values v ON v.option_id = o.id AND lower(v.value) = lower($3)
+			 WHERE o.product_id=$1 AND lower(o.name) = lower($2)`,
+			productID, name, value,
+		).Scan(&optionID, &valueID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", &fieldError{field, "is not an option of this product"}
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if !valueID.Valid {
+			return nil, "", &fieldError{field, fmt.Sprintf("has no value %q", value)}
+		}
+		if seen[optionID] {
+			return nil, "", &fieldError{field, "names the same option twice"}
+		}
+		seen[optionID] = true
+		ids = append(ids, valueID.Int64)
+	}
+	// A variant has exactly one value of every option of its product.
+	seenIDs := make([]int64, 0, len(seen))
+	for id := range seen {
+		seenIDs = append(seenIDs, id)
+	}
+	var missing sql.NullString
+	err := q.QueryRow(
+		"SELECT string_agg(name, ', ' ORDER BY id) FROM product_options WHERE product_id=$1 AND id <> ALL($2::int[])",
+		productID, seenIDs,
+	).Scan(&missing)
+	if err != nil {
+		return nil, "", err
+	}
+	if missing.Valid {
+		return nil, "", &fieldError{"options", "needs a value for " + missing.String}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return ids, strings.Join(parts, ","), nil
+}
+
+// skuTaken answers 409 when sku already belongs to a product or variant
+// other than the one being written, named by productID or variantID (the
+// other is 0). SKUs are unique across products and variants so that a
+// scan never matches two of them.
+func skuTaken(c *gin.Context, q rowQueryer, sku string, productID, variantID int64) bool {
+	if sku == "" {
+		return false
+	}
+	var owner string
+	err := q.QueryRow(
+		`SELECT 'product ' || id FROM products WHERE sku=$1 AND id<>$2
+		 UNION ALL
+		 SELECT 'variant ' || id FROM product_variants WHERE sku=$1 AND id<>$3
+		 LIMIT 1`,
+		sku, productID, variantID,
+	).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		failErr(c, err)
+		return true
+	}
+	fail(c, http.StatusConflict, codeAlreadyExists, owner+" already has this SKU",
+		models.FieldError{Field: "sku", Message: "is already in use"})
+	return true
+}
+
+// productOptions lists a product's options with their values, or only the
+// option optionID when it is not 0.
+func productOptions(q queryer, productID, optionID int64) ([]models.ProductOption, error) {
+	rows, err := q.Query(
+		`SELECT o.id, o.name, v.id, v.value FROM product_options o
+		 LEFT JOIN product_option_values v ON v.option_id = o.id
+		 WHERE o.product_id=$1 AND ($2 = 0 OR o.id=$2) ORDER BY o.id, v.id`,
+		productID, optionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := make([]models.ProductOption, 0)
+	for rows.Next() {
+		var opt models.ProductOption
+		var valueID sql.NullInt64
+		var value sql.NullString
+		if err := rows.Scan(&opt.ID, &opt.Name, &valueID, &value); err != nil {
+			return nil, err
+		}
+		if n := len(options); n == 0 || options[n-1].ID != opt.ID {
+			opt.ProductID = productID
+			opt.Values = make([]models.OptionValue, 0)
+			options = append(options, opt)
+		}
+		if valueID.Valid {
+			last := &options[len(options)-1]
+			last.Values = append(last.Values, models.OptionValue{ID: valueID.Int64, Value: value.String})
+		}
+	}
+	return options, rows.Err()
+}
+
+// loadVariant fetches one variant of a product, locking its row when
+// forUpdate is set.
+func loadVariant(q rowQueryer, productID, id int64, forUpdate bool) (models.Variant, error) {
+	query := variantSelect + " WHERE v.id=$1 AND v.product_id=$2"
+	if forUpdate {
+		query += " FOR UPDATE OF v"
+	}
+	return scanVariant(q.QueryRow(query, id, productID).Scan)
+}
+
+func scanVariant(scan func(dest ...any) error) (models.Variant, error) {
+	var v models.Variant
+	var options []byte
+	if err := scan(&v.ID, &v.ProductID, &v.SKU, &v.Price, &v.UnitPrice, &v.Stock, &v.Version, &v.CreatedAt, &options); err != nil {
+		return v, err
+	}
+	err := json.Unmarshal(options, &v.Options)
+	return v, err
+}
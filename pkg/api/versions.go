@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type deleteRequest struct {
+	Version *int `json:"version"`
+}
+
+// expectedVersion returns the resource version a client based its change
+// on, taken from the If-Match header or else the version field of the
+// request body. "If-Match: *" matches any version and yields nil. Requests
+// carrying neither are answered with 428.
+func expectedVersion(c *gin.Context, bodyVersion *int) (*int, bool) {
+	if h := strings.TrimSpace(c.GetHeader("If-Match")); h != "" {
+		if h == "*" {
+			return nil, true
+		}
+		v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(h, "W/"), `"`))
+		if err != nil {
+			fail(c, http.StatusBadRequest, codeInvalidRequest, "invalid If-Match header")
+			return nil, false
+		}
+		return &v, true
+	}
+	if bodyVersion != nil {
+		return bodyVersion, true
+	}
+	fail(c, http.StatusPreconditionRequired, codePreconditionRequired, "If-Match header or version field required")
+	return nil, false
+}
+
+// expectedDeleteVersion is expectedVersion for DELETE requests and other
+// requests such as archiving, whose body is optional.
+func expectedDeleteVersion(c *gin.Context) (*int, bool) {
+	var req deleteRequest
+	if c.Request.ContentLength != 0 {
+		if !bindJSON(c, &req) {
+			return nil, false
+		}
+	}
+	return expectedVersion(c, req.Version)
+}
+
+// versionMatches responds with 412 and the current version when the client
+// expected a different one.
+func versionMatches(c *gin.Context, want *int, current int, what string) bool {
+	if want == nil || *want == current {
+		return true
+	}
+	setETag(c, current)
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{
+		"error":   newAPIError(c, codeVersionMismatch, what+" was changed by someone else"),
+		"version": current,
+	})
+	return false
+}
+
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", `"`+strconv.Itoa(version)+`"`)
+}
@@ -7,7 +7,10 @@ import (
     "path/filepath"
 )
 
-func RunMigrations(conn *sql.DB, dir string) error {
+// RunMigrations applies every .sql file in dir that has not run yet, in
+// file name order. Each setting is visible to the migrations through
+// current_setting(name, true) for the length of their transaction.
+func RunMigrations(conn *sql.DB, dir string, settings map[string]string) error {
     if err := ensureMigrationsTable(conn); err != nil {
         return err
     }
@@ -33,7 +36,7 @@ func RunMigrations(conn *sql.DB, dir string) error {
         if err != nil {
             return err
         }
-        if err := runMigration(conn, e.Name(), string(sqlBytes)); err != nil {
+        if err := runMigration(conn, e.Name(), string(sqlBytes), settings); err != nil {
             return err
         }
     }
@@ -68,13 +71,19 @@ func appliedMigrations(conn *sql.DB) (map[string]bool, error) {
     return applied, rows.Err()
 }
 
-func runMigration(conn *sql.DB, name, sqlText string) error {
+func runMigration(conn *sql.DB, name, sqlText string, settings map[string]string) error {
     tx, err := conn.Begin()
     if err != nil {
         return err
     }
     defer tx.Rollback()
 
+    for key, value := range settings {
+        if _, err := tx.Exec("SELECT set_config($1, $2, true)", key, value); err != nil {
+            return fmt.Errorf("migration %s setting %s failed: %w", name, key, err)
+        }
+    }
+
     if _, err := tx.Exec(sqlText); err != nil {
         return fmt.Errorf("migration %s failed: %w", name, err)
     }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records one change made through the API: who made it, in
+// which request, and the resource before and after.
+type AuditEntry struct {
+	ID           int64           `json:"id"`
+	RequestID    string          `json:"request_id"`
+	ActorType    string          `json:"actor_type"`
+	ActorID      int64           `json:"actor_id"`
+	ActorName    string          `json:"actor_name"`
+	Method       string          `json:"method"`
+	Route        string          `json:"route"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   int64           `json:"resource_id"`
+	Action       string          `json:"action"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
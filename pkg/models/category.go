@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Category groups products. Categories form a tree: ParentID is nil for a
+// top-level category.
+type Category struct {
+	ID        int64     `json:"id"`
+	ParentID  *int64    `json:"parent_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "strings"
+
+// APIError is the body of every error response, sent under the "error"
+// key. Code is stable and meant for programs; Message is for people.
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// FieldError explains what is wrong with one field of a request body or
+// query string.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if len(e.Details) == 0 {
+		return e.Message
+	}
+	parts := make([]string, len(e.Details))
+	for i, d := range e.Details {
+		parts[i] = d.Field + " " + d.Message
+	}
+	return e.Message + ": " + strings.Join(parts, "; ")
+}
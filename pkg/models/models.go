@@ -2,32 +2,154 @@ package models
 
 import "time"
 
+// Product is a catalog entry. Price is the price in effect now, taken from
+// the product's price history.
 type Product struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Price     float64   `json:"price"`
-	Stock     int       `json:"stock"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	SKU        string     `json:"sku,omitempty"`
+	Barcode    string     `json:"barcode,omitempty"`
+	Price      Money      `json:"price"`
+	Stock      int        `json:"stock"`
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// ProductPrice is one entry of a product's price history: its price from
+// EffectiveFrom until EffectiveTo, or from then on when EffectiveTo is nil.
+type ProductPrice struct {
+	ID            int64      `json:"id"`
+	ProductID     int64      `json:"product_id"`
+	Price         Money      `json:"price"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+	CreatedAt     time.Time  `json:"created_at"`
 }
 
 type Customer struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Phone     string    `json:"phone"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Phone      string     `json:"phone"`
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
 }
 
+// PhoneConflict records a customer phone number that could not be kept
+// when phones moved to E.164 form. DuplicateOf is the customer that kept
+// the same number; it is nil when RawPhone is not a phone number at all.
+type PhoneConflict struct {
+	ID           int64     `json:"id"`
+	CustomerID   int64     `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	RawPhone     string    `json:"raw_phone"`
+	DuplicateOf  *int64    `json:"duplicate_of,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OrderItem is one line of an order. Discount and Tax are the line's share
+// of the order's discount and tax, so LineTotal - Discount + Tax is what
+// the customer paid for it.
 type OrderItem struct {
-	ID        int64   `json:"id"`
-	OrderID   int64   `json:"order_id"`
-	ProductID int64   `json:"product_id"`
-	Qty       int     `json:"qty"`
-	PriceEach float64 `json:"price_each"`
+	ID          int64 `json:"id"`
+	OrderID     int64 `json:"order_id"`
+	ProductID   int64 `json:"product_id"`
+	VariantID   int64 `json:"variant_id"`
+	Qty         int   `json:"qty"`
+	ReturnedQty int   `json:"returned_qty"`
+	PriceEach   Money `json:"price_each"`
+	LineTotal   Money `json:"line_total"`
+	Discount    Money `json:"discount"`
+	Tax         Money `json:"tax"`
 }
 
 type Order struct {
+	ID         int64           `json:"id"`
+	CustomerID int64           `json:"customer_id"`
+	Status     OrderStatus     `json:"status"`
+	Subtotal   Money           `json:"subtotal"`
+	Discount   Money           `json:"discount"`
+	Tax        Money           `json:"tax"`
+	Total      Money           `json:"total"`
+	Version    int             `json:"version"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Items      []OrderItem     `json:"items"`
+	Discounts  []OrderDiscount `json:"discounts"`
+}
+
+type OrderStatusChange struct {
 	ID         int64       `json:"id"`
-	CustomerID int64       `json:"customer_id"`
+	OrderID    int64       `json:"order_id"`
+	FromStatus OrderStatus `json:"from_status,omitempty"`
+	ToStatus   OrderStatus `json:"to_status"`
+	Note       string      `json:"note,omitempty"`
 	CreatedAt  time.Time   `json:"created_at"`
-	Items      []OrderItem `json:"items"`
+}
+
+// ReturnItem is one returned order line. Refund is the amount paid back
+// for it, including its share of the order's discount and tax; RefundEach
+// is that per unit, rounded to the cent.
+type ReturnItem struct {
+	ID          int64 `json:"id"`
+	ReturnID    int64 `json:"return_id"`
+	OrderItemID int64 `json:"order_item_id"`
+	ProductID   int64 `json:"product_id"`
+	Qty         int   `json:"qty"`
+	RefundEach  Money `json:"refund_each"`
+	Refund      Money `json:"refund"`
+}
+
+type Return struct {
+	ID           int64        `json:"id"`
+	OrderID      int64        `json:"order_id"`
+	Restocked    bool         `json:"restocked"`
+	RefundAmount Money        `json:"refund_amount"`
+	Reason       string       `json:"reason,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Items        []ReturnItem `json:"items"`
+}
+
+// Page is the envelope returned by list endpoints. NextCursor is passed back
+// as the after parameter to fetch the following page and is empty on the
+// last page.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type MovementReason string
+
+const (
+	MovementSale       MovementReason = "sale"
+	MovementReturn     MovementReason = "return"
+	MovementRestock    MovementReason = "restock"
+	MovementShrinkage  MovementReason = "shrinkage"
+	MovementCorrection MovementReason = "correction"
+)
+
+func (r MovementReason) Valid() bool {
+	switch r {
+	case MovementSale, MovementReturn, MovementRestock, MovementShrinkage, MovementCorrection:
+		return true
+	}
+	return false
+}
+
+// InventoryMovement is one entry of the append-only stock ledger. Delta is
+// the signed change applied to the product's stock and StockAfter the stock
+// level it left behind. Actor is the staff user or API key that made the
+// change. Opening marks the entry that stocked a new product or variant.
+type InventoryMovement struct {
+	ID         int64          `json:"id"`
+	ProductID  int64          `json:"product_id"`
+	VariantID  *int64         `json:"variant_id,omitempty"`
+	Delta      int            `json:"delta"`
+	Reason     MovementReason `json:"reason"`
+	Actor      string         `json:"actor,omitempty"`
+	Note       string         `json:"note,omitempty"`
+	OrderID    *int64         `json:"order_id,omitempty"`
+	StockAfter int            `json:"stock_after"`
+	Opening    bool           `json:"opening,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
 }
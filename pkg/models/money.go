@@ -0,0 +1,186 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in minor units (cents). It is stored as
+// NUMERIC(12,2) in the database and encoded as a decimal string in JSON so
+// that no client has to round-trip it through floating point.
+type Money int64
+
+var ErrMoneyPrecision = errors.New("amount has more than 2 decimal places")
+
+// ParseMoney parses a decimal amount such as "14.99", "-3.5" or "12".
+// Amounts with more than two significant decimal places are rejected.
+func ParseMoney(s string) (Money, error) {
+	text := strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(text, "-") {
+		neg = true
+		text = text[1:]
+	} else {
+		text = strings.TrimPrefix(text, "+")
+	}
+
+	whole, frac, _ := strings.Cut(text, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 2 {
+		return 0, ErrMoneyPrecision
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+	m := Money(units*100 + cents)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Mul returns the amount multiplied by a quantity.
+func (m Money) Mul(qty int) Money {
+	return m * Money(qty)
+}
+
+// Split divides m into parts in proportion to weights that add up to m
+// exactly: each part is rounded down and the cents left over go to the
+// parts with the largest remainders, earlier parts first on ties. All parts
+// are zero when the weights add up to zero. m and the weights must not be
+// negative.
+func (m Money) Split(weights []Money) []Money {
+	parts := make([]Money, len(weights))
+	var total int64
+	for _, w := range weights {
+		total += int64(w)
+	}
+	if total <= 0 || m == 0 {
+		return parts
+	}
+	// m * w can overflow int64 for large amounts.
+	divisor := big.NewInt(total)
+	remainders := make([]int64, len(weights))
+	order := make([]int, len(weights))
+	left := m
+	for i, w := range weights {
+		var q, r big.Int
+		q.QuoRem(new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(w))), divisor, &r)
+		parts[i] = Money(q.Int64())
+		remainders[i] = r.Int64()
+		order[i] = i
+		left -= parts[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:left] {
+		parts[i]++
+	}
+	return parts
+}
+
+// ApplyRate returns the amount scaled by a rate given in basis points
+// (825 = 8.25%), rounded half away from zero to the nearest cent.
+func (m Money) ApplyRate(bps int64) Money {
+	v := int64(m) * bps
+	if v < 0 {
+		return Money((v - 5000) / 10000)
+	}
+	return Money((v + 5000) / 10000)
+}
+
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+// UnmarshalJSON accepts both the string form produced by MarshalJSON and a
+// bare JSON number. Numbers are parsed from their literal text, never via
+// float64. A bad amount is reported as a *json.UnmarshalTypeError so the
+// decoder names the field it came from.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	text := string(b)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	v, err := ParseMoney(text)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: "amount " + text, Type: reflect.TypeOf(v)}
+	}
+	*m = v
+	return nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case string:
+		return m.scanText(v)
+	case []byte:
+		return m.scanText(string(v))
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = Money(math.Round(v * 100))
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
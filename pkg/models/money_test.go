@@ -0,0 +1,141 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"14.99", 1499},
+		{"12", 1200},
+		{"-3.5", -350},
+		{"+0.07", 7},
+		{".5", 50},
+		{"7.", 700},
+		{" 1.10 ", 110},
+		{"2.500", 250},
+		{"0", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMoneyErrors(t *testing.T) {
+	for _, in := range []string{"", ".", "-", "abc", "1.2.3", "1,50", "1e3", "--1", "99999999999999999999"} {
+		if got, err := ParseMoney(in); err == nil {
+			t.Errorf("ParseMoney(%q) = %s, want an error", in, got)
+		}
+	}
+	if _, err := ParseMoney("1.999"); !errors.Is(err, ErrMoneyPrecision) {
+		t.Errorf("ParseMoney(%q) error = %v, want ErrMoneyPrecision", "1.999", err)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{0, "0.00"},
+		{7, "0.07"},
+		{1499, "14.99"},
+		{-350, "-3.50"},
+		{-5, "-0.05"},
+		{100000, "1000.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.m), got, tt.want)
+		}
+		back, err := ParseMoney(tt.want)
+		if err != nil || back != tt.m {
+			t.Errorf("ParseMoney(%q) = %d, %v; want %d", tt.want, back, err, tt.m)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		A Money `json:"a"`
+		B Money `json:"b"`
+	}
+	if err := json.Unmarshal([]byte(`{"a": "12.30", "b": 0.1}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != 1230 || v.B != 10 {
+		t.Errorf("decoded a=%d b=%d, want 1230 and 10", v.A, v.B)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != `{"a":"12.30","b":"0.10"}` {
+		t.Errorf("encoded %s", got)
+	}
+	if err := json.Unmarshal([]byte(`{"a": "1.234"}`), &v); err == nil {
+		t.Error("decoding 1.234 succeeded, want an error")
+	}
+}
+
+func TestApplyRate(t *testing.T) {
+	tests := []struct {
+		m    Money
+		bps  int64
+		want Money
+	}{
+		{1000, 825, 83},   // 82.5 rounds up
+		{1000, 820, 82},   // 82.0
+		{-1000, 825, -83}, // away from zero
+		{199, 1000, 20},   // 19.9
+		{0, 825, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.ApplyRate(tt.bps); got != tt.want {
+			t.Errorf("Money(%d).ApplyRate(%d) = %d, want %d", int64(tt.m), tt.bps, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		m       Money
+		weights []Money
+		want    []Money
+	}{
+		{100, []Money{1, 1, 1}, []Money{34, 33, 33}},
+		{100, []Money{1, 2}, []Money{33, 67}},
+		{83, []Money{2000, 800, 1500}, []Money{39, 15, 29}},
+		{50, []Money{0, 10, 0}, []Money{0, 50, 0}},
+		{50, []Money{0, 0}, []Money{0, 0}},
+		{0, []Money{5, 5}, []Money{0, 0}},
+		// Large enough that m * weight overflows int64.
+		{100000000000000, []Money{100000000000000, 100000000000000}, []Money{50000000000000, 50000000000000}},
+	}
+	for _, tt := range tests {
+		got := tt.m.Split(tt.weights)
+		var sum Money
+		for i := range got {
+			sum += got[i]
+			if got[i] != tt.want[i] {
+				t.Errorf("Money(%d).Split(%v) = %v, want %v", int64(tt.m), tt.weights, got, tt.want)
+				break
+			}
+		}
+		if sum != tt.m && sum != 0 {
+			t.Errorf("Money(%d).Split(%v) adds up to %d", int64(tt.m), tt.weights, sum)
+		}
+	}
+}
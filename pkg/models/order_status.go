@@ -0,0 +1,46 @@
+package models
+
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderPaid      OrderStatus = "paid"
+	OrderFulfilled OrderStatus = "fulfilled"
+	OrderCompleted OrderStatus = "completed"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+// orderTransitions lists the statuses an order may move to from each status.
+// Completed and cancelled orders are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:   {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderFulfilled, OrderCancelled},
+	OrderFulfilled: {OrderCompleted},
+}
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderPending, OrderPaid, OrderFulfilled, OrderCompleted, OrderCancelled:
+		return true
+	}
+	return false
+}
+
+// Next returns the statuses reachable from s in a single transition.
+func (s OrderStatus) Next() []OrderStatus {
+	return orderTransitions[s]
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, n := range orderTransitions[s] {
+		if n == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Returnable reports whether goods from an order in status s may be returned.
+func (s OrderStatus) Returnable() bool {
+	return s == OrderPaid || s == OrderFulfilled || s == OrderCompleted
+}
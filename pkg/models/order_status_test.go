@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestOrderStatusTransitions(t *testing.T) {
+	statuses := []OrderStatus{OrderPending, OrderPaid, OrderFulfilled, OrderCompleted, OrderCancelled}
+	allowed := map[[2]OrderStatus]bool{
+		{OrderPending, OrderPaid}:        true,
+		{OrderPending, OrderCancelled}:   true,
+		{OrderPaid, OrderFulfilled}:      true,
+		{OrderPaid, OrderCancelled}:      true,
+		{OrderFulfilled, OrderCompleted}: true,
+	}
+	// Every pair not listed is forbidden, including staying in the same
+	// status and leaving a completed or cancelled order.
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]OrderStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, want)
+			}
+		}
+		if got := from.CanTransitionTo("refunded"); got {
+			t.Errorf("%s -> refunded allowed", from)
+		}
+	}
+	for _, final := range []OrderStatus{OrderCompleted, OrderCancelled} {
+		if next := final.Next(); len(next) != 0 {
+			t.Errorf("%s.Next() = %v, want none", final, next)
+		}
+	}
+}
+
+func TestOrderStatusReturnable(t *testing.T) {
+	tests := []struct {
+		status OrderStatus
+		want   bool
+	}{
+		{OrderPending, false},
+		{OrderPaid, true},
+		{OrderFulfilled, true},
+		{OrderCompleted, true},
+		{OrderCancelled, false},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Returnable(); got != tt.want {
+			t.Errorf("%s.Returnable() = %v, want %v", tt.status, got, tt.want)
+		}
+		if !tt.status.Valid() {
+			t.Errorf("%s.Valid() = false", tt.status)
+		}
+	}
+	if OrderStatus("refunded").Valid() {
+		t.Error(`"refunded" is a valid status`)
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type PromotionKind string
+
+const (
+	PromotionPercentOff PromotionKind = "percent_off"
+	PromotionAmountOff  PromotionKind = "amount_off"
+	PromotionBuyXGetY   PromotionKind = "buy_x_get_y"
+)
+
+// Promotion is a discount rule. With a Code it is a coupon that must be
+// given with the order; without one it applies automatically. ProductID or
+// CategoryID limit it to those items; MinSubtotal is the order subtotal it
+// needs. Uses counts the orders it was applied to, not counting cancelled
+// ones.
+type Promotion struct {
+	ID               int64         `json:"id"`
+	Name             string        `json:"name"`
+	Code             string        `json:"code,omitempty"`
+	Kind             PromotionKind `json:"kind"`
+	PercentOff       int           `json:"percent_off,omitempty"`
+	AmountOff        Money         `json:"amount_off,omitempty"`
+	BuyQty           int           `json:"buy_qty,omitempty"`
+	GetQty           int           `json:"get_qty,omitempty"`
+	ProductID        *int64        `json:"product_id,omitempty"`
+	CategoryID       *int64        `json:"category_id,omitempty"`
+	MinSubtotal      Money         `json:"min_subtotal"`
+	StartsAt         *time.Time    `json:"starts_at,omitempty"`
+	EndsAt           *time.Time    `json:"ends_at,omitempty"`
+	UsageLimit       *int          `json:"usage_limit,omitempty"`
+	PerCustomerLimit *int          `json:"per_customer_limit,omitempty"`
+	Uses             int           `json:"uses"`
+	Active           bool          `json:"active"`
+	Version          int           `json:"version"`
+	CreatedAt        time.Time     `json:"created_at"`
+}
+
+// OrderDiscount is one discount line of an order.
+type OrderDiscount struct {
+	ID          int64  `json:"id"`
+	OrderID     int64  `json:"order_id"`
+	PromotionID int64  `json:"promotion_id"`
+	Code        string `json:"code,omitempty"`
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+}
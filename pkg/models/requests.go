@@ -0,0 +1,81 @@
+package models
+
+// Request bodies shared by the API and the CLI. The validate tags are the
+// single source of the input rules; see pkg/validate.
+
+// NewProduct is the body of POST /products.
+type NewProduct struct {
+	Name    string `json:"name" validate:"notblank,max=100"`
+	SKU     string `json:"sku" validate:"omitempty,max=40,printascii"`
+	Barcode string `json:"barcode" validate:"barcode"`
+	Price   Money  `json:"price" validate:"min=0"`
+	Stock   int    `json:"stock" validate:"min=0"`
+}
+
+// NewCustomer is the body of POST /customers.
+type NewCustomer struct {
+	Name  string `json:"name" validate:"notblank,max=100"`
+	Phone string `json:"phone" validate:"phone"`
+}
+
+// NewOrder is the body of POST /orders. Each product variant may appear on
+// only one line; the quantity says how many. CouponCode is optional;
+// automatic promotions apply either way.
+type NewOrder struct {
+	CustomerID int64          `json:"customer_id" validate:"required,gt=0"`
+	Items      []NewOrderItem `json:"items" validate:"required,min=1,max=50,dive"`
+	CouponCode string         `json:"coupon_code,omitempty" validate:"max=40"`
+}
+
+// NewOrderItem names what to sell by variant_id, or by product_id for a
+// product with a single variant.
+type NewOrderItem struct {
+	ProductID int64 `json:"product_id,omitempty" validate:"min=0"`
+	VariantID int64 `json:"variant_id,omitempty" validate:"min=0"`
+	Qty       int   `json:"qty" validate:"gt=0,max=1000"`
+}
+
+// NewReturn is the body of POST /orders/:id/returns. Each order item may
+// appear on only one line.
+type NewReturn struct {
+	Items   []NewReturnItem `json:"items" validate:"required,min=1,dive"`
+	Restock bool            `json:"restock"`
+	Reason  string          `json:"reason"`
+}
+
+// NewReturnItem says how many units of one order item come back.
+type NewReturnItem struct {
+	OrderItemID int64 `json:"order_item_id" validate:"gt=0"`
+	Qty         int   `json:"qty" validate:"gt=0"`
+}
+
+// StockAdjustment is the body of POST /products/:id/stock/adjustments.
+// Sales and returns are recorded by the order endpoints, so manual
+// adjustments use the remaining reasons: a restock adds stock, shrinkage
+// removes it and a correction goes either way.
+type StockAdjustment struct {
+	VariantID *int64         `json:"variant_id,omitempty" validate:"omitnil,gt=0"`
+	Delta     int            `json:"delta" validate:"ne=0"`
+	Reason    MovementReason `json:"reason" validate:"oneof=restock shrinkage correction"`
+	Note      string         `json:"note"`
+}
+
+// NewUser is the body of POST /admin/users.
+type NewUser struct {
+	Username string `json:"username" validate:"notblank"`
+	Password string `json:"password" validate:"min=8"`
+	Role     Role   `json:"role" validate:"oneof=admin clerk readonly"`
+}
+
+// PasswordChange is the body of POST /auth/password.
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" validate:"min=8"`
+}
+
+// NewAPIKey is the body of POST /admin/api-keys. Name says who or what
+// uses the key.
+type NewAPIKey struct {
+	Name string `json:"name" validate:"notblank"`
+	Role Role   `json:"role" validate:"oneof=admin clerk readonly"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Role controls what an API key may do. Each role includes the permissions
+// of the ones below it: admin > clerk > readonly.
+type Role string
+
+const (
+	RoleReadonly Role = "readonly"
+	RoleClerk    Role = "clerk"
+	RoleAdmin    Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleReadonly: 1,
+	RoleClerk:    2,
+	RoleAdmin:    3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Allows reports whether r grants at least the permissions of required.
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[required]
+}
+
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Role      Role       `json:"role"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// User is a member of staff who logs in with a username and password.
+type User struct {
+	ID         int64      `json:"id"`
+	Username   string     `json:"username"`
+	Role       Role       `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ProductOption is a way a product varies, such as "Color", with the values
+// it comes in.
+type ProductOption struct {
+	ID        int64         `json:"id"`
+	ProductID int64         `json:"product_id"`
+	Name      string        `json:"name"`
+	Values    []OptionValue `json:"values"`
+}
+
+type OptionValue struct {
+	ID    int64  `json:"id"`
+	Value string `json:"value"`
+}
+
+// Variant is one stocked and sold form of a product, such as the red mug.
+// Every product has at least one; a product without options has exactly
+// one, with no Options. Price is nil when the variant sells at the
+// product's price; UnitPrice is what it sells for either way.
+type Variant struct {
+	ID        int64             `json:"id"`
+	ProductID int64             `json:"product_id"`
+	SKU       string            `json:"sku,omitempty"`
+	Price     *Money            `json:"price"`
+	UnitPrice Money             `json:"unit_price"`
+	Stock     int               `json:"stock"`
+	Options   map[string]string `json:"options"`
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -0,0 +1,37 @@
+package validate
+
+import "errors"
+
+var ErrBarcode = errors.New("not a valid EAN-13 or UPC-A barcode")
+
+// NormalizeBarcode checks the check digit of an EAN-13 or UPC-A barcode and
+// returns it as 13 digits; a UPC-A gets a leading zero, which makes it the
+// equivalent EAN-13. An empty input stays empty.
+func NormalizeBarcode(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if len(s) == 12 {
+		s = "0" + s
+	}
+	if len(s) != 13 {
+		return "", ErrBarcode
+	}
+	// Weights alternate 1 and 3 from the left; with the check digit the
+	// sum must be a multiple of ten.
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		d := int(s[i] - '0')
+		if d < 0 || d > 9 {
+			return "", ErrBarcode
+		}
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	if sum%10 != 0 {
+		return "", ErrBarcode
+	}
+	return s, nil
+}
@@ -0,0 +1,43 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeBarcode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"4006381333931", "4006381333931"}, // EAN-13
+		{"9780306406157", "9780306406157"}, // ISBN-13
+		{"036000291452", "0036000291452"},  // UPC-A gets a leading zero
+		{"0036000291452", "0036000291452"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeBarcode(tt.in)
+		if err != nil {
+			t.Errorf("NormalizeBarcode(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeBarcode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeBarcodeErrors(t *testing.T) {
+	for _, in := range []string{
+		"4006381333932", // wrong check digit
+		"036000291453",  // wrong UPC-A check digit
+		"4006381333",    // too short
+		"40063813339310",
+		"40063813339a1",
+		"4006381-33931",
+	} {
+		if got, err := NormalizeBarcode(in); !errors.Is(err, ErrBarcode) {
+			t.Errorf("NormalizeBarcode(%q) = %q, %v; want ErrBarcode", in, got, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrPhone = errors.New("not a valid phone number")
+
+// NormalizePhone rewrites a phone number in E.164 form, e.g. "+15550101".
+// Numbers written with a leading + or 00 keep their own country code; any
+// other number is taken as local and gets countryCode (digits only, such as
+// "1") in front. Spaces, dots, dashes and parentheses are dropped. An empty
+// input stays empty.
+func NormalizePhone(s, countryCode string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if !phonePattern.MatchString(s) {
+		return "", ErrPhone
+	}
+	var digits strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(s, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	default:
+		number = countryCode + strings.TrimLeft(number, "0")
+	}
+	// E.164 allows at most 15 digits and no country code starts with 0.
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrPhone
+	}
+	return "+" + number, nil
+}
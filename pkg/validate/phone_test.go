@@ -0,0 +1,54 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"+1 555 010 1234", "+15550101234"},
+		{"+44 (20) 7946-0958", "+442079460958"},
+		{"0044 20 7946 0958", "+442079460958"},
+		{"555.010.1234", "+15550101234"},
+		{"555 (010) 1234", "+15550101234"},
+		{"0555 0101", "+15550101"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.in, "1")
+		if err != nil {
+			t.Errorf("NormalizePhone(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizePhoneCountryCode(t *testing.T) {
+	got, err := NormalizePhone("030 1234567", "49")
+	if err != nil || got != "+49301234567" {
+		t.Errorf("NormalizePhone with country code 49 = %q, %v; want +49301234567", got, err)
+	}
+}
+
+func TestNormalizePhoneErrors(t *testing.T) {
+	for _, in := range []string{
+		"call me",
+		"555-CALL-NOW",
+		"12345",              // too short for the pattern
+		"+1 234",             // too short for E.164
+		"+0 555 010 1234",    // no country code starts with 0
+		"+1234567890123456",  // more than 15 digits
+		"1 555 010 1234 ext", // trailing text
+	} {
+		if got, err := NormalizePhone(in, "1"); !errors.Is(err, ErrPhone) {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want ErrPhone", in, got, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package validate checks request bodies against the validate tags on their
+// fields. The server and the CLI share it, so a form is rejected locally
+// for the same reasons the API would reject it.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"terminal_store/pkg/models"
+)
+
+// phonePattern is deliberately loose: digits with the usual separators and
+// an optional leading +.
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ().-]{5,18}[0-9]$`)
+
+var v = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	// An empty phone means "no phone"; add required to demand one.
+	v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		s := fl.Field().String()
+		return s == "" || phonePattern.MatchString(s)
+	})
+	v.RegisterValidation("barcode", func(fl validator.FieldLevel) bool {
+		_, err := NormalizeBarcode(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	v.RegisterStructValidation(checkOrderItems, models.NewOrder{})
+	v.RegisterStructValidation(checkReturnItems, models.NewReturn{})
+	v.RegisterStructValidation(checkStockAdjustment, models.StockAdjustment{})
+	return v
+}
+
+// checkReturnItems rejects an order item listed on two lines of a return,
+// pointing at the later one.
+func checkReturnItems(sl validator.StructLevel) {
+	ret := sl.Current().Interface().(models.NewReturn)
+	seen := make(map[int64]bool, len(ret.Items))
+	for i, it := range ret.Items {
+		if seen[it.OrderItemID] {
+			sl.ReportError(it.OrderItemID, fmt.Sprintf("items[%d].order_item_id", i), "OrderItemID", "unique", "")
+		}
+		seen[it.OrderItemID] = true
+	}
+}
+
+// checkStockAdjustment requires a restock to add stock and shrinkage to
+// remove it.
+func checkStockAdjustment(sl validator.StructLevel) {
+	adj := sl.Current().Interface().(models.StockAdjustment)
+	switch {
+	case adj.Reason == models.MovementRestock && adj.Delta < 0:
+		sl.ReportError(adj.Delta, "delta", "Delta", "sign", "positive for a restock")
+	case adj.Reason == models.MovementShrinkage && adj.Delta > 0:
+		sl.ReportError(adj.Delta, "delta", "Delta", "sign", "negative for shrinkage")
+	}
+}
+
+// checkOrderItems requires every order line to name a product or variant
+// and rejects a variant, or a product given without a variant, listed on
+// two lines, pointing at the later one.
+func checkOrderItems(sl validator.StructLevel) {
+	order := sl.Current().Interface().(models.NewOrder)
+	type key struct{ product, variant int64 }
+	seen := make(map[key]bool, len(order.Items))
+	for i, it := range order.Items {
+		if it.ProductID == 0 && it.VariantID == 0 {
+			sl.ReportError(it.ProductID, fmt.Sprintf("items[%d].product_id", i), "ProductID", "required_without", "variant_id")
+			continue
+		}
+		k := key{variant: it.VariantID}
+		field, name := fmt.Sprintf("items[%d].variant_id", i), "VariantID"
+		if it.VariantID == 0 {
+			k = key{product: it.ProductID}
+			field, name = fmt.Sprintf("items[%d].product_id", i), "ProductID"
+		}
+		if seen[k] {
+			sl.ReportError(it.ProductID, field, name, "unique", "")
+		}
+		seen[k] = true
+	}
+}
+
+// Struct validates s and returns one FieldError per failing field, named
+// by its JSON path such as "items[1].qty". It returns nil when s is valid.
+func Struct(s any) []models.FieldError {
+	err := v.Struct(s)
+	if err == nil {
+		return nil
+	}
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return []models.FieldError{{Message: err.Error()}}
+	}
+	details := make([]models.FieldError, len(errs))
+	for i, fe := range errs {
+		// The namespace starts with the Go type name, e.g. "NewOrder.items[0].qty".
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		details[i] = models.FieldError{Field: field, Message: message(fe)}
+	}
+	return details
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "is required when " + fe.Param() + " is not given"
+	case "required_if":
+		// The parameter is a Go field name and value, e.g. "Kind percent_off".
+		field, value, _ := strings.Cut(fe.Param(), " ")
+		return "is required when " + strings.ToLower(field) + " is " + value
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "notblank":
+		return "must not be blank"
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "ne":
+		return "must not be " + fe.Param()
+	case "sign":
+		return "must be " + fe.Param()
+	case "min", "max":
+		bound := "at least "
+		if fe.Tag() == "max" {
+			bound = "at most "
+		}
+		switch fe.Kind() {
+		case reflect.String:
+			if fe.Tag() == "min" && fe.Param() == "1" {
+				return "must not be empty"
+			}
+			return "must be " + bound + fe.Param() + " characters"
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return "must have " + bound + fe.Param() + " entries"
+		}
+		if fe.Tag() == "min" && fe.Param() == "0" {
+			return "must not be negative"
+		}
+		return "must be " + bound + fe.Param()
+	case "unique":
+		return "repeats an earlier entry"
+	case "phone":
+		return "must be a phone number such as +1 555 010 1234"
+	case "barcode":
+		return "must be a 13-digit EAN or 12-digit UPC with a correct check digit"
+	case "printascii":
+		return "must only contain letters, digits and punctuation"
+	}
+	return fmt.Sprintf("failed the %q rule", fe.Tag())
+}
@@ -0,0 +1,107 @@
+package validate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"terminal_store/pkg/models"
+)
+
+func TestStruct(t *testing.T) {
+	manyItems := make([]models.NewOrderItem, 51)
+	for i := range manyItems {
+		manyItems[i] = models.NewOrderItem{ProductID: int64(i + 1), Qty: 1}
+	}
+	fe := func(field, message string) models.FieldError {
+		return models.FieldError{Field: field, Message: message}
+	}
+	tests := []struct {
+		name string
+		req  any
+		want []models.FieldError
+	}{
+		{"product", models.NewProduct{Name: "Mug", Price: 1250, Stock: 3}, nil},
+		{"negative price", models.NewProduct{Name: "Mug", Price: -1}, []models.FieldError{fe("price", "must not be negative")}},
+		{"long product name", models.NewProduct{Name: strings.Repeat("x", 101)}, []models.FieldError{fe("name", "must be at most 100 characters")}},
+
+		{"customer without phone", models.NewCustomer{Name: "Ava Carter"}, nil},
+		{"customer with phone", models.NewCustomer{Name: "Ava Carter", Phone: "+1 (555) 010-1234"}, nil},
+		{"letters in phone", models.NewCustomer{Name: "Ava Carter", Phone: "call me"}, []models.FieldError{fe("phone", "must be a phone number such as +1 555 010 1234")}},
+		{"short phone", models.NewCustomer{Name: "Ava Carter", Phone: "12345"}, []models.FieldError{fe("phone", "must be a phone number such as +1 555 010 1234")}},
+
+		{"order", models.NewOrder{CustomerID: 1, Items: []models.NewOrderItem{{ProductID: 1, Qty: 2}, {VariantID: 4, Qty: 1}}}, nil},
+		{"order without items", models.NewOrder{CustomerID: 1}, []models.FieldError{fe("items", "is required")}},
+		{"too many items", models.NewOrder{CustomerID: 1, Items: manyItems}, []models.FieldError{fe("items", "must have at most 50 entries")}},
+		{"too many units", models.NewOrder{CustomerID: 1, Items: []models.NewOrderItem{{ProductID: 1, Qty: 1001}}}, []models.FieldError{fe("items[0].qty", "must be at most 1000")}},
+		{"item without product or variant", models.NewOrder{CustomerID: 1, Items: []models.NewOrderItem{{Qty: 1}}},
+			[]models.FieldError{fe("items[0].product_id", "is required when variant_id is not given")}},
+		{"product twice", models.NewOrder{CustomerID: 1, Items: []models.NewOrderItem{{ProductID: 1, Qty: 1}, {ProductID: 2, Qty: 1}, {ProductID: 1, Qty: 3}}},
+			[]models.FieldError{fe("items[2].product_id", "repeats an earlier entry")}},
+		{"variant twice", models.NewOrder{CustomerID: 1, Items: []models.NewOrderItem{{VariantID: 5, Qty: 1}, {ProductID: 1, VariantID: 5, Qty: 1}}},
+			[]models.FieldError{fe("items[1].variant_id", "repeats an earlier entry")}},
+		{"product and its variant", models.NewOrder{CustomerID: 1, Items: []models.NewOrderItem{{ProductID: 1, Qty: 1}, {ProductID: 1, VariantID: 5, Qty: 1}}}, nil},
+
+		{"restock", models.StockAdjustment{Delta: 12, Reason: models.MovementRestock}, nil},
+		{"negative restock", models.StockAdjustment{Delta: -2, Reason: models.MovementRestock}, []models.FieldError{fe("delta", "must be positive for a restock")}},
+		{"shrinkage", models.StockAdjustment{Delta: -2, Reason: models.MovementShrinkage}, nil},
+		{"positive shrinkage", models.StockAdjustment{Delta: 2, Reason: models.MovementShrinkage}, []models.FieldError{fe("delta", "must be negative for shrinkage")}},
+		{"correction either way", models.StockAdjustment{Delta: -2, Reason: models.MovementCorrection}, nil},
+		{"zero delta", models.StockAdjustment{Reason: models.MovementCorrection}, []models.FieldError{fe("delta", "must not be 0")}},
+		{"sale by hand", models.StockAdjustment{Delta: -1, Reason: models.MovementSale}, []models.FieldError{fe("reason", "must be one of restock, shrinkage, correction")}},
+
+		{"every failing field", models.NewOrder{
+			Items: []models.NewOrderItem{
+				{ProductID: 1, Qty: 0},
+				{Qty: 1},
+				{ProductID: 1, Qty: 1},
+			},
+			CouponCode: strings.Repeat("X", 41),
+		}, []models.FieldError{
+			fe("customer_id", "is required"),
+			fe("items[0].qty", "must be greater than 0"),
+			fe("coupon_code", "must be at most 40 characters"),
+			fe("items[1].product_id", "is required when variant_id is not given"),
+			fe("items[2].product_id", "repeats an earlier entry"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErrors(t, Struct(tt.req), tt.want)
+		})
+	}
+}
+
+func TestNotBlank(t *testing.T) {
+	tests := []struct {
+		name string
+		req  any
+		want []models.FieldError
+	}{
+		{"product", models.NewProduct{Name: "Mug"}, nil},
+		{"empty product name", models.NewProduct{}, []models.FieldError{{Field: "name", Message: "must not be blank"}}},
+		{"blank product name", models.NewProduct{Name: " \t "}, []models.FieldError{{Field: "name", Message: "must not be blank"}}},
+		{"customer", models.NewCustomer{Name: "Ava Carter"}, nil},
+		{"blank customer name", models.NewCustomer{Name: "   "}, []models.FieldError{{Field: "name", Message: "must not be blank"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErrors(t, Struct(tt.req), tt.want)
+		})
+	}
+}
+
+// checkErrors compares field errors regardless of their order, so a test
+// does not depend on which rules the validator runs first.
+func checkErrors(t *testing.T, got, want []models.FieldError) {
+	t.Helper()
+	key := func(a, b models.FieldError) int {
+		return strings.Compare(a.Field+"\x00"+a.Message, b.Field+"\x00"+b.Message)
+	}
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.SortFunc(got, key)
+	slices.SortFunc(want, key)
+	if !slices.Equal(got, want) {
+		t.Errorf("Struct = %v, want %v", got, want)
+	}
+}
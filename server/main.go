@@ -18,7 +18,13 @@ func main() {
 	}
     defer conn.Close()
 
-    if err := db.RunMigrations(conn, "migrations"); err != nil {
+    // Migrations normalize stored phone numbers the way the API does.
+    settings := map[string]string{"app.phone_country_code": api.PhoneCountryCodeFromEnv()}
+    if err := db.RunMigrations(conn, "migrations", settings); err != nil {
+        log.Fatal(err)
+    }
+
+    if err := api.BootstrapAdminKey(conn, os.Getenv("ADMIN_API_KEY")); err != nil {
         log.Fatal(err)
     }
 